@@ -0,0 +1,23 @@
+package adapters
+
+import (
+	"errors"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+//adaptError converts goesl errors to their fs counterparts so eslsession and apps only check fs errors
+func adaptError(err error) error {
+	var reply *goesl.ReplyError
+	var conn *goesl.ConnectionError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &reply):
+		return &fs.CommandError{Command: reply.Command, Reply: reply.Reply}
+	case errors.As(err, &conn):
+		return &fs.ConnectionError{Err: err}
+	}
+	return err
+}
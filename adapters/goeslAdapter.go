@@ -13,7 +13,57 @@ type EslWrapper struct {
 //ReadMessage wrapper
 func (c *EslWrapper) ReadMessage() (fs.IEvent, error) {
 	msg, err := c.Client.ReadMessage()
-	return &MessageWrapper{Message: msg}, err
+	return &MessageWrapper{Message: msg}, adaptError(err)
+}
+
+//Send wrapper
+func (c *EslWrapper) Send(cmd string) error {
+	return adaptError(c.Client.Send(cmd))
+}
+
+//SendMsg wrapper
+func (c *EslWrapper) SendMsg(cmd map[string]string, uuid string, data string) error {
+	return adaptError(c.Client.SendMsg(cmd, uuid, data))
+}
+
+//BgAPI wrapper
+func (c *EslWrapper) BgAPI(cmd string, uuid string) error {
+	return adaptError(c.Client.BgAPI(cmd, uuid))
+}
+
+//API wrapper
+func (c *EslWrapper) API(cmd string) (string, error) {
+	body, err := c.Client.API(cmd)
+	return body, adaptError(err)
+}
+
+//Events wrapper
+func (c *EslWrapper) Events(format string, events ...string) error {
+	return adaptError(c.Client.Events(format, events...))
+}
+
+//NixEvent wrapper
+func (c *EslWrapper) NixEvent(events ...string) error {
+	return adaptError(c.Client.NixEvent(events...))
+}
+
+//MyEvents wrapper
+func (c *EslWrapper) MyEvents(format string, uuid string) error {
+	return adaptError(c.Client.MyEvents(format, uuid))
+}
+
+//Linger wrapper
+func (c *EslWrapper) Linger(seconds int) error {
+	return adaptError(c.Client.Linger(seconds))
+}
+
+//Reconnect re-establishes client connection and starts handling its messages
+func (c *EslWrapper) Reconnect() error {
+	if err := c.Client.Reconnect(); err != nil {
+		return err
+	}
+	go c.Client.Handle()
+	return nil
 }
 
 //MessageWrapper wrapper around goesl message
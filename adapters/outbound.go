@@ -0,0 +1,85 @@
+package adapters
+
+import (
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+var (
+	adapterLogger = l.NewLogger("adapters")
+)
+
+//SocketWrapper wrapper goesl SocketConnection accepted by OutboundServer to abstract goesl out of eslsession
+type SocketWrapper struct {
+	*goesl.SocketConnection
+}
+
+//ReadMessage wrapper
+func (c *SocketWrapper) ReadMessage() (fs.IEvent, error) {
+	msg, err := c.SocketConnection.ReadMessage()
+	return &MessageWrapper{Message: msg}, adaptError(err)
+}
+
+//Send wrapper
+func (c *SocketWrapper) Send(cmd string) error {
+	return adaptError(c.SocketConnection.Send(cmd))
+}
+
+//SendMsg wrapper
+func (c *SocketWrapper) SendMsg(cmd map[string]string, uuid string, data string) error {
+	return adaptError(c.SocketConnection.SendMsg(cmd, uuid, data))
+}
+
+//BgAPI wrapper
+func (c *SocketWrapper) BgAPI(cmd string, uuid string) error {
+	return adaptError(c.SocketConnection.BgAPI(cmd, uuid))
+}
+
+//API wrapper
+func (c *SocketWrapper) API(cmd string) (string, error) {
+	body, err := c.SocketConnection.API(cmd)
+	return body, adaptError(err)
+}
+
+//Events wrapper
+func (c *SocketWrapper) Events(format string, events ...string) error {
+	return adaptError(c.SocketConnection.Events(format, events...))
+}
+
+//NixEvent wrapper
+func (c *SocketWrapper) NixEvent(events ...string) error {
+	return adaptError(c.SocketConnection.NixEvent(events...))
+}
+
+//MyEvents wrapper
+func (c *SocketWrapper) MyEvents(format string, uuid string) error {
+	return adaptError(c.SocketConnection.MyEvents(format, uuid))
+}
+
+//Linger wrapper
+func (c *SocketWrapper) Linger(seconds int) error {
+	return adaptError(c.SocketConnection.Linger(seconds))
+}
+
+//ServeOutbound starts server and runs apps created by factory on every connection accepted from
+//freeswitch socket application. Returns when server stops
+func ServeOutbound(server *goesl.OutboundServer, factory eslsession.EslAppFactory) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Start()
+	}()
+	for {
+		select {
+		case conn := <-server.Conns:
+			go func() {
+				defer conn.Close()
+				err := eslsession.OutboundConnectionHandler(&SocketWrapper{SocketConnection: conn}, factory)
+				adapterLogger.Debug("outbound connection from %s ended: %v", conn.OriginatorAddr(), err)
+			}()
+		case err := <-errs:
+			return err
+		}
+	}
+}
@@ -0,0 +1,362 @@
+//Package campaign places outbound calls to a list of destinations through eslsession and runs an app on
+//every answered call, limiting concurrent channels and calls per second like max-sessions and
+//sessions-per-second of switch.conf.xml do
+package campaign
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+var (
+	campaignLogger = l.NewLogger("campaign")
+)
+
+//SetLogLevel set loglevel for campaign logger
+func SetLogLevel(l int) {
+	campaignLogger.SetLevel(l)
+}
+
+//ErrStopped is error of attempts which were not made because campaign was stopped
+var ErrStopped = errors.New("campaign stopped")
+
+//DefaultParkTimeout is how long an answered call may take to reach its app, later it is hung up and its slot is freed
+var DefaultParkTimeout = 10 * time.Second
+
+//Originator places calls, *eslsession.SessionManager implements it
+type Originator interface {
+	Originate(r eslsession.OriginateRequest, factory eslsession.EslAppFactory) (string, error)
+	//API runs an api command, answered calls which do not park are hung up by uuid_kill
+	API(cmd string) (string, error)
+}
+
+//Destination is one number to call
+type Destination struct {
+	//ID identifies destination in results, e.g. customer id
+	ID         string
+	DialString string
+	//Variables are added to Config.Variables for calls of this destination
+	Variables map[string]string
+}
+
+//Config controls how a campaign places calls
+type Config struct {
+	//MaxConcurrent is maximum number of channels at once, 0 means 1
+	MaxConcurrent int
+	//CallsPerSecond is maximum rate of originates, 0 means no limit
+	CallsPerSecond float64
+	//MaxAttempts is number of tries of a destination, 0 means 1
+	MaxAttempts int
+	//RetryCauses are originate failure causes which are retried e.g. NO_ANSWER, USER_BUSY
+	RetryCauses []string
+	//RetryDelay is wait time before retrying a destination
+	RetryDelay time.Duration
+
+	CallerIDName   string
+	CallerIDNumber string
+	//Timeout is seconds to wait for answer, see eslsession.OriginateRequest
+	Timeout   int
+	Variables map[string]string
+
+	//OnResult is called after every attempt from the goroutine which made it, so it may run concurrently
+	OnResult func(Result)
+}
+
+//Result is outcome of one attempt of a destination
+type Result struct {
+	Destination Destination
+	//Attempt starts from 1
+	Attempt int
+	//UUID is channel uuid of answered calls
+	UUID     string
+	Answered bool
+	//Cause is hangup cause of a failed originate
+	Cause string
+	//Err is set if the attempt failed, *fs.OriginateError for rejected or unanswered calls
+	Err error
+	//Retry is true if destination will be tried again
+	Retry   bool
+	Started time.Time
+	Ended   time.Time
+}
+
+type attempt struct {
+	destination Destination
+	number      int
+}
+
+//Campaign calls its destinations once Run is called
+type Campaign struct {
+	originator   Originator
+	config       Config
+	destinations []Destination
+	factory      eslsession.EslAppFactory
+
+	queue   chan attempt
+	slots   chan struct{}
+	pending sync.WaitGroup
+	stop    chan struct{}
+	once    sync.Once
+
+	mtx    sync.Mutex
+	resume chan struct{} //not nil while paused, closed on resume
+}
+
+//New creates a campaign which runs apps created by factory on answered calls to destinations
+func New(o Originator, config Config, destinations []Destination, factory eslsession.EslAppFactory) *Campaign {
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 1
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 1
+	}
+	return &Campaign{
+		originator:   o,
+		config:       config,
+		destinations: destinations,
+		factory:      factory,
+		queue:        make(chan attempt, len(destinations)),
+		slots:        make(chan struct{}, config.MaxConcurrent),
+		stop:         make(chan struct{}),
+	}
+}
+
+//Pause stops placing new calls, calls in progress continue
+func (c *Campaign) Pause() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.resume == nil {
+		c.resume = make(chan struct{})
+		campaignLogger.Info("paused")
+	}
+}
+
+//Resume continues placing calls after Pause
+func (c *Campaign) Resume() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.resume != nil {
+		close(c.resume)
+		c.resume = nil
+		campaignLogger.Info("resumed")
+	}
+}
+
+//Stop gives up remaining attempts, Run returns when calls in progress end
+func (c *Campaign) Stop() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+//Run places calls until every destination is answered, fails finally or campaign is stopped.
+//Returns after apps of all answered calls return and their channels are destroyed
+func (c *Campaign) Run() {
+	for _, d := range c.destinations {
+		c.pending.Add(1)
+		c.queue <- attempt{destination: d, number: 1}
+	}
+	finished := make(chan struct{})
+	go func() {
+		c.pending.Wait()
+		close(finished)
+	}()
+
+	var interval time.Duration
+	if c.config.CallsPerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / c.config.CallsPerSecond)
+	}
+	var last time.Time
+	for {
+		var a attempt
+		select {
+		case a = <-c.queue:
+		case <-finished:
+			return
+		case <-c.stop:
+			c.drain(finished)
+			return
+		}
+		if !c.waitTurn(&last, interval) {
+			c.giveUp(a)
+			c.drain(finished)
+			return
+		}
+		go c.dial(a)
+	}
+}
+
+//waitTurn blocks while paused, until a channel slot is free and call rate allows. false if stopped
+func (c *Campaign) waitTurn(last *time.Time, interval time.Duration) bool {
+	for {
+		c.mtx.Lock()
+		resume := c.resume
+		c.mtx.Unlock()
+		if resume == nil {
+			break
+		}
+		select {
+		case <-resume:
+		case <-c.stop:
+			return false
+		}
+	}
+	select {
+	case c.slots <- struct{}{}:
+	case <-c.stop:
+		return false
+	}
+	if wait := interval - time.Since(*last); interval > 0 && wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-c.stop:
+			<-c.slots
+			return false
+		}
+	}
+	*last = time.Now()
+	return true
+}
+
+//drain gives up queued attempts and retries scheduled after stop until every attempt is done
+func (c *Campaign) drain(finished chan struct{}) {
+	for {
+		select {
+		case a := <-c.queue:
+			c.giveUp(a)
+		case <-finished:
+			return
+		}
+	}
+}
+
+func (c *Campaign) giveUp(a attempt) {
+	now := time.Now()
+	c.report(Result{Destination: a.destination, Attempt: a.number, Err: ErrStopped, Started: now, Ended: now})
+	c.pending.Done()
+}
+
+//dial makes one attempt holding a channel slot until its app returns and its channel is destroyed
+func (c *Campaign) dial(a attempt) {
+	r := Result{Destination: a.destination, Attempt: a.number, Started: time.Now()}
+	parked := make(chan fs.ISession, 1)
+	ended := make(chan struct{})
+	var mtx sync.Mutex
+	late := false
+	factory := func(s fs.ISession) eslsession.IEslApp {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if late { //its slot is freed already, so app is not run
+			return hangupApp{session: s}
+		}
+		parked <- s
+		return &trackedApp{IEslApp: c.factory(s), ended: ended}
+	}
+	wait := func(s fs.ISession) {
+		<-ended
+		<-s.Done() //app may return before its channel is hung up
+	}
+
+	var err error
+	r.UUID, err = c.originator.Originate(c.request(a.destination), factory)
+	if err == nil {
+		r.Answered = true
+		select {
+		case s := <-parked:
+			wait(s)
+		case <-time.After(DefaultParkTimeout):
+			mtx.Lock()
+			late = true
+			mtx.Unlock()
+			select {
+			case s := <-parked: //parked while timing out
+				wait(s)
+			default:
+				r.Err = errors.New("answered call did not park")
+				c.hangup(r.UUID)
+			}
+		}
+	} else {
+		r.Err = err
+		var oe *fs.OriginateError
+		if errors.As(err, &oe) {
+			r.Cause = oe.Cause
+		}
+	}
+	<-c.slots
+	r.Ended = time.Now()
+	r.Retry = !r.Answered && a.number < c.config.MaxAttempts && c.retryable(r.Cause)
+	campaignLogger.Debug("attempt %d of %s ended answered:%v cause:%s", a.number, a.destination.DialString, r.Answered, r.Cause)
+	c.report(r)
+	if !r.Retry {
+		c.pending.Done()
+		return
+	}
+	time.AfterFunc(c.config.RetryDelay, func() {
+		c.queue <- attempt{destination: a.destination, number: a.number + 1}
+	})
+}
+
+//hangup kills channel of an answered call which did not park
+func (c *Campaign) hangup(channelUUID string) {
+	if _, err := c.originator.API("uuid_kill " + channelUUID + " ORIGINATOR_CANCEL"); err != nil {
+		campaignLogger.Debug("channel %s which did not park is gone: %s", channelUUID, err)
+	}
+}
+
+func (c *Campaign) request(d Destination) eslsession.OriginateRequest {
+	vars := make(map[string]string, len(c.config.Variables)+len(d.Variables))
+	for k, v := range c.config.Variables {
+		vars[k] = v
+	}
+	for k, v := range d.Variables {
+		vars[k] = v
+	}
+	return eslsession.OriginateRequest{
+		DialString:     d.DialString,
+		CallerIDName:   c.config.CallerIDName,
+		CallerIDNumber: c.config.CallerIDNumber,
+		Timeout:        c.config.Timeout,
+		Variables:      vars,
+	}
+}
+
+func (c *Campaign) retryable(cause string) bool {
+	for _, rc := range c.config.RetryCauses {
+		if rc == cause {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Campaign) report(r Result) {
+	if c.config.OnResult != nil {
+		c.config.OnResult(r)
+	}
+}
+
+//trackedApp tells campaign when app of an answered call returns
+type trackedApp struct {
+	eslsession.IEslApp
+	ended chan struct{}
+}
+
+func (app *trackedApp) Run() {
+	defer close(app.ended)
+	app.IEslApp.Run()
+}
+
+//hangupApp hangs up calls which park after their attempt gave up waiting for them
+type hangupApp struct {
+	session fs.ISession
+}
+
+func (hangupApp) IsApplicable(fs.IEvent) bool { return true }
+func (hangupApp) Setup(fs.IEvent)             {}
+func (app hangupApp) Run() {
+	app.session.Hangup("ORIGINATOR_CANCEL")
+}
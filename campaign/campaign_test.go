@@ -0,0 +1,233 @@
+package campaign
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+//fakeOriginator fails calls of dial strings found in causes in order, others are answered and their app runs.
+//Answered channels park after parkDelay and are destroyed linger after their app returns
+type fakeOriginator struct {
+	mtx      sync.Mutex
+	causes   map[string][]string
+	calls    []time.Time
+	apis     []string
+	sessions []*fakeSession
+
+	parkDelay time.Duration
+	linger    time.Duration
+	active    int32
+	maxActive int32
+}
+
+//fakeSession is channel of an answered call, only Done and Hangup are implemented
+type fakeSession struct {
+	fs.ISession
+	done   chan struct{}
+	hungUp int32
+}
+
+func (s *fakeSession) Done() <-chan struct{} { return s.done }
+
+func (s *fakeSession) Hangup(cause ...string) (fs.IEvent, error) {
+	atomic.StoreInt32(&s.hungUp, 1)
+	return nil, nil
+}
+
+func (o *fakeOriginator) API(cmd string) (string, error) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.apis = append(o.apis, cmd)
+	return "+OK", nil
+}
+
+func (o *fakeOriginator) Originate(r eslsession.OriginateRequest, factory eslsession.EslAppFactory) (string, error) {
+	n := atomic.AddInt32(&o.active, 1)
+	for {
+		max := atomic.LoadInt32(&o.maxActive)
+		if n <= max || atomic.CompareAndSwapInt32(&o.maxActive, max, n) {
+			break
+		}
+	}
+	o.mtx.Lock()
+	o.calls = append(o.calls, time.Now())
+	var cause string
+	if causes := o.causes[r.DialString]; len(causes) > 0 {
+		cause, o.causes[r.DialString] = causes[0], causes[1:]
+	}
+	o.mtx.Unlock()
+
+	if cause != "" {
+		atomic.AddInt32(&o.active, -1)
+		return "", &fs.OriginateError{DialString: r.DialString, Cause: cause}
+	}
+	s := &fakeSession{done: make(chan struct{})}
+	o.mtx.Lock()
+	o.sessions = append(o.sessions, s)
+	o.mtx.Unlock()
+	go func() {
+		defer atomic.AddInt32(&o.active, -1)
+		time.Sleep(o.parkDelay)
+		factory(s).Run()
+		time.Sleep(o.linger)
+		close(s.done)
+	}()
+	return "uuid-" + r.DialString, nil
+}
+
+type sleepApp struct{}
+
+func (sleepApp) IsApplicable(fs.IEvent) bool { return true }
+func (sleepApp) Setup(fs.IEvent)             {}
+func (sleepApp) Run()                        { time.Sleep(20 * time.Millisecond) }
+
+func sleepFactory(fs.ISession) eslsession.IEslApp { return sleepApp{} }
+
+func destinations(n int) []Destination {
+	var list []Destination
+	for i := 0; i < n; i++ {
+		list = append(list, Destination{ID: string(rune('a' + i)), DialString: "user/" + string(rune('a'+i))})
+	}
+	return list
+}
+
+func TestMain(m *testing.M) {
+	SetLogLevel(l.ERROR)
+	os.Exit(m.Run())
+}
+
+func TestCampaignLimitsAndRetries(t *testing.T) {
+	o := &fakeOriginator{causes: map[string][]string{
+		"user/a": {"NO_ANSWER", "USER_BUSY"},
+		"user/b": {"CALL_REJECTED"},
+		"user/c": {"NO_ANSWER", "NO_ANSWER", "NO_ANSWER"},
+	}, linger: 20 * time.Millisecond}
+	var mtx sync.Mutex
+	var results []Result
+	c := New(o, Config{
+		MaxConcurrent: 3,
+		MaxAttempts:   3,
+		RetryCauses:   []string{"NO_ANSWER", "USER_BUSY"},
+		OnResult: func(r Result) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			results = append(results, r)
+		},
+	}, destinations(10), sleepFactory)
+	c.Run()
+
+	if max := atomic.LoadInt32(&o.maxActive); max > 3 {
+		t.Errorf("%d concurrent calls, limit is 3", max)
+	}
+	answered := map[string]int{}
+	attempts := map[string]int{}
+	for _, r := range results {
+		attempts[r.Destination.ID]++
+		if r.Answered {
+			answered[r.Destination.ID]++
+		}
+	}
+	if len(answered) != 8 || answered["a"] != 1 || answered["b"] != 0 || answered["c"] != 0 {
+		t.Errorf("unexpected answered destinations %v", answered)
+	}
+	if attempts["a"] != 3 || attempts["b"] != 1 || attempts["c"] != 3 {
+		t.Errorf("unexpected attempts %v", attempts)
+	}
+	for _, r := range results {
+		if r.Destination.ID == "b" && (r.Cause != "CALL_REJECTED" || r.Retry || !errors.Is(r.Err, fs.ErrOriginateFailed)) {
+			t.Errorf("unexpected result of rejected call %+v", r)
+		}
+	}
+}
+
+func TestCampaignCallsPerSecond(t *testing.T) {
+	o := &fakeOriginator{}
+	c := New(o, Config{MaxConcurrent: 10, CallsPerSecond: 50}, destinations(6), sleepFactory)
+	c.Run()
+	if len(o.calls) != 6 {
+		t.Fatalf("expected 6 calls, got %d", len(o.calls))
+	}
+	for i := 1; i < len(o.calls); i++ {
+		if gap := o.calls[i].Sub(o.calls[i-1]); gap < 15*time.Millisecond {
+			t.Errorf("calls %d and %d are %s apart, expected 20ms", i-1, i, gap)
+		}
+	}
+}
+
+func TestCampaignPauseResumeStop(t *testing.T) {
+	o := &fakeOriginator{}
+	var stopped int32
+	c := New(o, Config{MaxConcurrent: 1, OnResult: func(r Result) {
+		if errors.Is(r.Err, ErrStopped) {
+			atomic.AddInt32(&stopped, 1)
+		}
+	}}, destinations(5), sleepFactory)
+	c.Pause()
+	done := make(chan struct{})
+	go func() {
+		c.Run()
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	o.mtx.Lock()
+	calls := len(o.calls)
+	o.mtx.Unlock()
+	if calls != 0 {
+		t.Fatalf("%d calls placed while paused", calls)
+	}
+	c.Resume()
+	time.Sleep(30 * time.Millisecond)
+	c.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+	o.mtx.Lock()
+	calls = len(o.calls)
+	o.mtx.Unlock()
+	if calls == 0 || calls == 5 || calls+int(atomic.LoadInt32(&stopped)) != 5 {
+		t.Errorf("expected some of 5 destinations to be stopped, %d called and %d stopped", calls, stopped)
+	}
+}
+
+func TestCampaignLatePark(t *testing.T) {
+	defer func(d time.Duration) { DefaultParkTimeout = d }(DefaultParkTimeout)
+	DefaultParkTimeout = 20 * time.Millisecond
+	o := &fakeOriginator{parkDelay: 50 * time.Millisecond}
+	var ran int32
+	var results []Result
+	c := New(o, Config{OnResult: func(r Result) { results = append(results, r) }}, destinations(1),
+		func(fs.ISession) eslsession.IEslApp {
+			atomic.AddInt32(&ran, 1)
+			return sleepApp{}
+		})
+	c.Run()
+
+	if len(results) != 1 || !results[0].Answered || results[0].Err == nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	o.mtx.Lock()
+	apis, s := o.apis, o.sessions[0]
+	o.mtx.Unlock()
+	if len(apis) != 1 || apis[0] != "uuid_kill uuid-user/a ORIGINATOR_CANCEL" {
+		t.Errorf("call which did not park is not killed %v", apis)
+	}
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("late call did not park")
+	}
+	if atomic.LoadInt32(&s.hungUp) != 1 || atomic.LoadInt32(&ran) != 0 {
+		t.Errorf("late call ran app instead of hanging up, hung up:%d apps:%d", s.hungUp, ran)
+	}
+}
@@ -0,0 +1,58 @@
+package dialplan
+
+import (
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//App runs a dialplan context on a parked channel the way freeswitch xml dialplan does
+type App struct {
+	session fs.ISession
+	context *Context
+	data    fs.IEvent
+}
+
+//AppFactory creates an eslsession app factory which hunts given context for each parked channel.
+//Channels with no matching extension are not applicable
+func (d *Dialplan) AppFactory(context string) eslsession.EslAppFactory {
+	c := d.Context(context)
+	if c == nil {
+		dialplanLogger.Error("context %s not found, no channel will be applicable", context)
+	}
+	return func(s fs.ISession) eslsession.IEslApp {
+		return &App{
+			session: s,
+			context: c,
+		}
+	}
+}
+
+//IsApplicable true if any extension of context matches the channel
+func (app *App) IsApplicable(event fs.IEvent) bool {
+	if app.context == nil {
+		return false
+	}
+	steps, err := app.context.Hunt(NewVariables(event), nil)
+	return err == nil && len(steps) > 0
+}
+
+//Setup keeps channel data used for hunting
+func (app *App) Setup(channelData fs.IEvent) {
+	app.data = channelData
+}
+
+//Run hunts the context executing inline actions then executes queued actions
+func (app *App) Run() {
+	v := NewVariables(app.data)
+	steps, err := app.context.Hunt(v, func(name string, data string) error {
+		_, err := app.session.Exec(name, data)
+		return err
+	})
+	if err != nil {
+		dialplanLogger.Error("hunting %s failed: %s", app.data.GetHeader("Unique-ID"), err)
+		return
+	}
+	if err = Execute(app.session, steps, v); err != nil {
+		dialplanLogger.Error("executing %s failed: %s", app.data.GetHeader("Unique-ID"), err)
+	}
+}
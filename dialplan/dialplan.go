@@ -0,0 +1,173 @@
+package dialplan
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+var (
+	dialplanLogger = l.NewLogger("dialplan")
+)
+
+//SetLogLevel set loglevel for dialplan logger
+func SetLogLevel(l int) {
+	dialplanLogger.SetLevel(l)
+}
+
+//break attribute values of a condition, same as freeswitch
+const (
+	BreakOnFalse = "on-false"
+	BreakOnTrue  = "on-true"
+	BreakAlways  = "always"
+	BreakNever   = "never"
+)
+
+//Dialplan holds all contexts found in a freeswitch xml document
+type Dialplan struct {
+	Contexts map[string]*Context
+}
+
+//Context is a named list of extensions which are hunted in order
+type Context struct {
+	Name       string       `xml:"name,attr"`
+	Extensions []*Extension `xml:"extension"`
+}
+
+//Extension same as freeswitch <extension>
+type Extension struct {
+	Name       string       `xml:"name,attr"`
+	Continue   string       `xml:"continue,attr"`
+	Conditions []*Condition `xml:"condition"`
+}
+
+//Condition same as freeswitch <condition>, Break defaults to on-false. Only field/expression conditions
+//are supported
+type Condition struct {
+	Field       string    `xml:"field,attr"`
+	Expression  string    `xml:"expression,attr"`
+	Break       string    `xml:"break,attr"`
+	Actions     []*Action `xml:"action"`
+	AntiActions []*Action `xml:"anti-action"`
+
+	//UnsupportedAttrs and UnsupportedElements collect what is not implemented e.g. time of day attributes
+	//(wday, hour, ...) or regex="any" with <regex> children, Parse fails on them
+	UnsupportedAttrs    []xml.Attr `xml:",any,attr"`
+	UnsupportedElements []element  `xml:",any"`
+
+	re *regexp.Regexp
+}
+
+//element is an xml element known only by its name
+type element struct {
+	XMLName xml.Name
+}
+
+//Action same as freeswitch <action> and <anti-action>
+type Action struct {
+	Application string `xml:"application,attr"`
+	Data        string `xml:"data,attr"`
+	Inline      string `xml:"inline,attr"`
+}
+
+//IsInline true if action must be executed while hunting
+func (a *Action) IsInline() bool {
+	return a.Inline == "true"
+}
+
+//Parse reads a freeswitch xml document and collects every <context> in it.
+//Extensions outside of any context are put in context "default" so a bare list
+//of extensions can be loaded too. Conditions using anything but field, expression and break are an error
+func Parse(r io.Reader) (*Dialplan, error) {
+	d := &Dialplan{Contexts: make(map[string]*Context)}
+	decoder := xml.NewDecoder(r)
+	for {
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "context":
+			c := &Context{}
+			if err := decoder.DecodeElement(c, &se); err != nil {
+				return nil, err
+			}
+			if existing, found := d.Contexts[c.Name]; found {
+				existing.Extensions = append(existing.Extensions, c.Extensions...)
+			} else {
+				d.Contexts[c.Name] = c
+			}
+		case "extension":
+			e := &Extension{}
+			if err := decoder.DecodeElement(e, &se); err != nil {
+				return nil, err
+			}
+			c, found := d.Contexts["default"]
+			if !found {
+				c = &Context{Name: "default"}
+				d.Contexts["default"] = c
+			}
+			c.Extensions = append(c.Extensions, e)
+		}
+	}
+	for _, c := range d.Contexts {
+		if err := c.compile(); err != nil {
+			return nil, err
+		}
+	}
+	dialplanLogger.Debug("loaded %d contexts", len(d.Contexts))
+	return d, nil
+}
+
+//ParseFile loads a dialplan from an xml file
+func ParseFile(path string) (*Dialplan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+//Context returns context by name or nil
+func (d *Dialplan) Context(name string) *Context {
+	return d.Contexts[name]
+}
+
+func (c *Context) compile() error {
+	for _, e := range c.Extensions {
+		for _, cond := range e.Conditions {
+			if len(cond.UnsupportedAttrs) > 0 {
+				return fmt.Errorf("context %s extension %s: unsupported condition attribute %s", c.Name, e.Name,
+					cond.UnsupportedAttrs[0].Name.Local)
+			}
+			if len(cond.UnsupportedElements) > 0 {
+				return fmt.Errorf("context %s extension %s: unsupported condition element <%s>", c.Name, e.Name,
+					cond.UnsupportedElements[0].XMLName.Local)
+			}
+			if cond.Break == "" {
+				cond.Break = BreakOnFalse
+			}
+			if cond.Field == "" {
+				continue
+			}
+			re, err := regexp.Compile(cond.Expression)
+			if err != nil {
+				return fmt.Errorf("context %s extension %s: invalid expression %q: %s", c.Name, e.Name, cond.Expression, err)
+			}
+			cond.re = re
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package dialplan
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+var (
+	captureRegex  = regexp.MustCompile(`\$(\d)`)
+	variableRegex = regexp.MustCompile(`\$\{([^${}]+)\}`)
+
+	//callerFields maps condition fields which freeswitch reads from caller profile to event headers
+	callerFields = map[string]string{
+		"username":           "Caller-Username",
+		"dialplan":           "Caller-Dialplan",
+		"caller_id_name":     "Caller-Caller-ID-Name",
+		"caller_id_number":   "Caller-Caller-ID-Number",
+		"callee_id_name":     "Caller-Callee-ID-Name",
+		"callee_id_number":   "Caller-Callee-ID-Number",
+		"ani":                "Caller-ANI",
+		"aniii":              "Caller-ANI-II",
+		"network_addr":       "Caller-Network-Addr",
+		"rdnis":              "Caller-RDNIS",
+		"destination_number": "Caller-Destination-Number",
+		"uuid":               "Caller-Unique-ID",
+		"source":             "Caller-Source",
+		"context":            "Caller-Context",
+		"chan_name":          "Caller-Channel-Name",
+	}
+)
+
+//Step is an application queued by hunting, Data has regex captures applied but
+//variables are expanded right before execution
+type Step struct {
+	Extension   string
+	Application string
+	Data        string
+}
+
+//InlineFunc executes an inline action while hunting
+type InlineFunc func(app string, data string) error
+
+//Variables resolves condition fields and ${var} references from channel data (usually the park event)
+//plus variables set by dialplan actions so far
+type Variables struct {
+	data fs.IEvent
+	vars map[string]string
+}
+
+//NewVariables creates a variable table over channel data event
+func NewVariables(channelData fs.IEvent) *Variables {
+	return &Variables{
+		data: channelData,
+		vars: make(map[string]string),
+	}
+}
+
+//Get returns a variable or caller profile field
+func (v *Variables) Get(name string) (string, bool) {
+	if val, found := v.vars[name]; found {
+		return val, true
+	}
+	if v.data == nil {
+		return "", false
+	}
+	if h, isField := callerFields[name]; isField {
+		if val := v.data.GetHeader(h); val != "" {
+			return val, true
+		}
+	}
+	if val := v.data.GetHeader("variable_" + name); val != "" {
+		return val, true
+	}
+	return "", false
+}
+
+//Set sets a variable for the rest of hunting and execution
+func (v *Variables) Set(name string, value string) {
+	v.vars[name] = value
+}
+
+//Expand replaces ${var} with known values. Unknown variables, api calls like ${sofia_contact(...)}
+//and $${global} references are left untouched to be expanded by freeswitch itself
+func (v *Variables) Expand(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range variableRegex.FindAllStringSubmatchIndex(s, -1) {
+		if m[0] > 0 && s[m[0]-1] == '$' {
+			continue
+		}
+		name := s[m[2]:m[3]]
+		if strings.ContainsAny(name, "( ") {
+			continue
+		}
+		val, found := v.Get(name)
+		if !found {
+			continue
+		}
+		b.WriteString(s[last:m[0]])
+		b.WriteString(val)
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+//apply tracks effect of variable manipulating applications
+func (v *Variables) apply(app string, data string) {
+	switch app {
+	case "set", "export":
+		if i := strings.Index(data, "="); i > 0 {
+			name := strings.TrimPrefix(data[:i], "nolocal:")
+			v.vars[name] = data[i+1:]
+		}
+	case "unset":
+		v.vars[data] = ""
+	}
+}
+
+func (v *Variables) fieldValue(field string) string {
+	if strings.Contains(field, "${") {
+		return v.Expand(field)
+	}
+	val, _ := v.Get(field)
+	return val
+}
+
+func substituteCaptures(data string, captures []string) string {
+	return captureRegex.ReplaceAllStringFunc(data, func(m string) string {
+		n, _ := strconv.Atoi(m[1:])
+		if n < len(captures) {
+			return captures[n]
+		}
+		return ""
+	})
+}
+
+func (c *Condition) test(v *Variables) (bool, []string) {
+	if c.re == nil {
+		return true, nil
+	}
+	captures := c.re.FindStringSubmatch(v.fieldValue(c.Field))
+	return captures != nil, captures
+}
+
+func (c *Condition) breaks(pass bool) bool {
+	switch c.Break {
+	case BreakAlways:
+		return true
+	case BreakNever:
+		return false
+	case BreakOnTrue:
+		return pass
+	default:
+		return !pass
+	}
+}
+
+//hunt evaluates conditions of extension. Like freeswitch an extension is matched if its last evaluated
+//condition passed, actions or anti-actions queued by failed conditions are kept but hunting goes on
+func (e *Extension) hunt(v *Variables, inline InlineFunc) (bool, []Step, error) {
+	var steps []Step
+	matched := false
+	for _, c := range e.Conditions {
+		pass, captures := c.test(v)
+		matched = pass
+		dialplanLogger.Debug("extension %s: condition %s=~%s => %t", e.Name, c.Field, c.Expression, pass)
+		actions := c.AntiActions
+		if pass {
+			actions = c.Actions
+		}
+		for _, a := range actions {
+			data := a.Data
+			if pass {
+				data = substituteCaptures(data, captures)
+			}
+			if a.IsInline() {
+				data = v.Expand(data)
+				if inline != nil {
+					if err := inline(a.Application, data); err != nil {
+						return matched, steps, err
+					}
+				}
+				v.apply(a.Application, data)
+				continue
+			}
+			steps = append(steps, Step{Extension: e.Name, Application: a.Application, Data: data})
+		}
+		if c.breaks(pass) {
+			break
+		}
+	}
+	return matched, steps, nil
+}
+
+//Hunt walks extensions in order and returns queued applications. Inline actions are passed to
+//inline as they are met, a nil inline makes hunting side effect free (inline variables are still tracked)
+func (c *Context) Hunt(v *Variables, inline InlineFunc) ([]Step, error) {
+	var steps []Step
+	for _, e := range c.Extensions {
+		matched, esteps, err := e.hunt(v, inline)
+		if err != nil {
+			return steps, err
+		}
+		steps = append(steps, esteps...)
+		if !matched {
+			continue
+		}
+		dialplanLogger.Debug("matched extension %s in context %s", e.Name, c.Name)
+		if e.Continue != "true" {
+			break
+		}
+	}
+	return steps, nil
+}
+
+//Execute runs hunted steps on session. Variables are expanded just before each step so
+//values set by previous steps are visible like they are in freeswitch
+func Execute(session fs.ISession, steps []Step, v *Variables) error {
+	for _, step := range steps {
+		data := v.Expand(step.Data)
+		dialplanLogger.Debug("executing %s(%s) from extension %s", step.Application, data, step.Extension)
+		if _, err := session.Exec(step.Application, data); err != nil {
+			return err
+		}
+		v.apply(step.Application, data)
+	}
+	return nil
+}
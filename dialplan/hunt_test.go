@@ -0,0 +1,113 @@
+package dialplan_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/babakyakhchali/go-esl-wrapper/dialplan"
+)
+
+//channel is channel data of a parked call
+type channel map[string]string
+
+func (c channel) GetHeader(name string) string { return c[name] }
+func (c channel) GetHeaderValues(name string) []string {
+	if v, found := c[name]; found {
+		return []string{v}
+	}
+	return nil
+}
+func (c channel) GetBody() []byte { return nil }
+func (c channel) GetType() string { return "CHANNEL_PARK" }
+
+const huntXML = `<include>
+<context name="default">
+  <extension name="anti">
+    <condition field="destination_number" expression="^9999$">
+      <action application="log" data="never"/>
+      <anti-action application="set" data="anti=yes"/>
+    </condition>
+  </extension>
+  <extension name="vars" continue="true">
+    <condition field="destination_number" expression="^(10)(\d\d)$">
+      <action application="set" data="ext=$2" inline="true"/>
+      <action application="set" data="prefix=$1"/>
+    </condition>
+  </extension>
+  <extension name="broken">
+    <condition field="${ext}" expression="^99$"/>
+    <condition field="destination_number" expression="^.*$">
+      <action application="log" data="unreachable"/>
+    </condition>
+  </extension>
+  <extension name="never-break">
+    <condition field="${ext}" expression="^99$" break="never"/>
+    <condition field="caller_id_number" expression="^2000$">
+      <action application="bridge" data="user/${ext}@${domain_name}"/>
+    </condition>
+  </extension>
+  <extension name="after">
+    <condition field="destination_number" expression="^1000$">
+      <action application="log" data="after"/>
+    </condition>
+  </extension>
+</context>
+<context name="empty">
+  <extension name="no-actions">
+    <condition field="destination_number" expression="^1000$"/>
+  </extension>
+  <extension name="after">
+    <condition field="destination_number" expression="^1000$">
+      <action application="log" data="after"/>
+    </condition>
+  </extension>
+</context>
+</include>`
+
+func TestHunt(t *testing.T) {
+	d, err := dialplan.Parse(strings.NewReader(huntXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := dialplan.NewVariables(channel{"Caller-Destination-Number": "1000", "Caller-Caller-ID-Number": "2000"})
+	var inlines []string
+	steps, err := d.Context("default").Hunt(v, func(app string, data string) error {
+		inlines = append(inlines, app+" "+data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []dialplan.Step{
+		{Extension: "anti", Application: "set", Data: "anti=yes"},
+		{Extension: "vars", Application: "set", Data: "prefix=10"},
+		{Extension: "never-break", Application: "bridge", Data: "user/${ext}@${domain_name}"},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("unexpected steps %+v", steps)
+	}
+	if !reflect.DeepEqual(inlines, []string{"set ext=00"}) {
+		t.Errorf("unexpected inline actions %v", inlines)
+	}
+	if data := v.Expand(steps[2].Data); data != "user/00@${domain_name}" {
+		t.Errorf("unexpected expansion %s", data)
+	}
+
+	steps, err = d.Context("empty").Hunt(dialplan.NewVariables(channel{"Caller-Destination-Number": "1000"}), nil)
+	if err != nil || len(steps) != 0 {
+		t.Errorf("extension without actions did not stop hunting %+v %v", steps, err)
+	}
+}
+
+func TestParseUnsupportedCondition(t *testing.T) {
+	for _, cond := range []string{
+		`<condition wday="2-6" hour="9-17"><action application="log" data="open"/></condition>`,
+		`<condition regex="any"><regex field="destination_number" expression="^1000$"/></condition>`,
+	} {
+		_, err := dialplan.Parse(strings.NewReader(`<extension name="office">` + cond + `</extension>`))
+		if err == nil || !strings.Contains(err.Error(), "unsupported condition") {
+			t.Errorf("%s is parsed, error %v", cond, err)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package eslsession
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//ConferenceSubclass is subclass of CUSTOM events mod_conference reports rooms and members by
+const ConferenceSubclass = "conference::maniacs"
+
+//conferenceArg builds argument of conference application, room@profile+pin+flags{a|b}
+func conferenceArg(room string, o fs.ConferenceOptions) string {
+	arg := room
+	if o.Profile != "" {
+		arg += "@" + o.Profile
+	}
+	if o.PIN != "" {
+		arg += "+" + o.PIN
+	}
+	if len(o.Flags) > 0 {
+		arg += "+flags{" + strings.Join(o.Flags, "|") + "}"
+	}
+	return arg
+}
+
+//Conference runs conference application on managed channel, it returns when channel leaves room by
+//hangup, kick or transfer
+func (s *Session) Conference(room string, o fs.ConferenceOptions) (fs.IEvent, error) {
+	return s.exec("conference", conferenceArg(room, o))
+}
+
+//ConferenceMember is state of a conference member as reported by conference::maniacs events
+type ConferenceMember struct {
+	//ID is member id in room, used by conference api commands
+	ID             string
+	UUID           string
+	CallerIDName   string
+	CallerIDNumber string
+	Moderator      bool
+	Muted          bool
+	Deaf           bool
+	Talking        bool
+}
+
+type conferenceRoom struct {
+	locked  bool
+	members map[string]ConferenceMember
+}
+
+//ConferenceController tracks conference rooms by conference::maniacs events of a manager and controls them
+//with conference api commands. Member arguments of commands are a member id, all, last or non_moderator
+type ConferenceController struct {
+	manager *SessionManager
+
+	mtx      sync.Mutex
+	rooms    map[string]*conferenceRoom
+	handlers []conferenceHandler
+
+	//refreshing counts running Refresh calls, events applied meanwhile are kept in pending and applied
+	//again to listed rooms so those arriving around json_list are not lost
+	refreshing int
+	pending    []fs.IEvent
+}
+
+type conferenceHandler struct {
+	action  string
+	handler fs.EventHandlerFunc
+}
+
+//NewConferenceController subscribes conference::maniacs events of m and starts tracking rooms.
+//Rooms existing before are not known until an event of them arrives or Refresh is called
+func NewConferenceController(m *SessionManager) (*ConferenceController, error) {
+	c := &ConferenceController{manager: m, rooms: map[string]*conferenceRoom{}}
+	if err := m.AddCustomEventHandler(ConferenceSubclass, c.onEvent); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//AddHandler calls handler for conference events with Action header action e.g. add-member or
+//mute-member, "" for all actions. Handlers run on global handlers goroutine after state is updated
+func (c *ConferenceController) AddHandler(action string, handler fs.EventHandlerFunc) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.handlers = append(c.handlers, conferenceHandler{action: action, handler: handler})
+}
+
+//room returns room named name creating it, mtx must be held
+func (c *ConferenceController) room(name string) *conferenceRoom {
+	r, ok := c.rooms[name]
+	if !ok {
+		r = &conferenceRoom{members: map[string]ConferenceMember{}}
+		c.rooms[name] = r
+	}
+	return r
+}
+
+func memberFromEvent(e fs.IEvent) ConferenceMember {
+	return ConferenceMember{
+		ID:             e.GetHeader("Member-ID"),
+		UUID:           e.GetHeader("Unique-ID"),
+		CallerIDName:   e.GetHeader("Caller-Caller-ID-Name"),
+		CallerIDNumber: e.GetHeader("Caller-Caller-ID-Number"),
+		Moderator:      e.GetHeader("Member-Type") == "moderator",
+		Muted:          e.GetHeader("Speak") == "false",
+		Deaf:           e.GetHeader("Hear") == "false",
+		Talking:        e.GetHeader("Talking") == "true",
+	}
+}
+
+func (c *ConferenceController) onEvent(e fs.IEvent) {
+	name, action := e.GetHeader("Conference-Name"), e.GetHeader("Action")
+	if name == "" {
+		return
+	}
+	c.mtx.Lock()
+	c.apply(e)
+	if c.refreshing > 0 {
+		c.pending = append(c.pending, e)
+	}
+	var handlers []fs.EventHandlerFunc
+	for _, h := range c.handlers {
+		if h.action == "" || h.action == action {
+			handlers = append(handlers, h.handler)
+		}
+	}
+	c.mtx.Unlock()
+	for _, h := range handlers {
+		h(e)
+	}
+}
+
+//apply updates rooms by event e, mtx must be held. Member events carry whole member state so applying
+//events again in order leaves rooms as they were after the last one
+func (c *ConferenceController) apply(e fs.IEvent) {
+	name, action := e.GetHeader("Conference-Name"), e.GetHeader("Action")
+	switch action {
+	case "conference-create":
+		c.room(name)
+	case "conference-destroy":
+		delete(c.rooms, name)
+	case "lock", "unlock":
+		c.room(name).locked = action == "lock"
+	case "del-member", "kick-member":
+		if r, ok := c.rooms[name]; ok {
+			delete(r.members, e.GetHeader("Member-ID"))
+		}
+	default: //member events carry whole member state
+		if id := e.GetHeader("Member-ID"); id != "" {
+			c.room(name).members[id] = memberFromEvent(e)
+		}
+	}
+}
+
+//Rooms returns names of known rooms
+func (c *ConferenceController) Rooms() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	names := make([]string, 0, len(c.rooms))
+	for name := range c.rooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Members returns members of room ordered by id
+func (c *ConferenceController) Members(room string) []ConferenceMember {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	r, ok := c.rooms[room]
+	if !ok {
+		return nil
+	}
+	members := make([]ConferenceMember, 0, len(r.members))
+	for _, m := range r.members {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, _ := strconv.Atoi(members[i].ID)
+		b, _ := strconv.Atoi(members[j].ID)
+		return a < b
+	})
+	return members
+}
+
+//Member returns member of room with id
+func (c *ConferenceController) Member(room string, id string) (ConferenceMember, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if r, ok := c.rooms[room]; ok {
+		m, ok := r.members[id]
+		return m, ok
+	}
+	return ConferenceMember{}, false
+}
+
+//Locked reports if room is locked
+func (c *ConferenceController) Locked(room string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	r, ok := c.rooms[room]
+	return ok && r.locked
+}
+
+//jsonConference is a room in reply of conference json_list
+type jsonConference struct {
+	Name    string `json:"conference_name"`
+	Locked  bool   `json:"locked"`
+	Members []struct {
+		Type           string `json:"type"`
+		ID             int    `json:"id"`
+		UUID           string `json:"uuid"`
+		CallerIDName   string `json:"caller_id_name"`
+		CallerIDNumber string `json:"caller_id_number"`
+		Flags          struct {
+			CanHear     bool `json:"can_hear"`
+			CanSpeak    bool `json:"can_speak"`
+			Talking     bool `json:"talking"`
+			IsModerator bool `json:"is_moderator"`
+		} `json:"flags"`
+	} `json:"members"`
+}
+
+//Refresh replaces tracked state with rooms listed by conference json_list. Events received while
+//waiting for the list are applied to listed rooms again
+func (c *ConferenceController) Refresh() error {
+	c.mtx.Lock()
+	c.refreshing++
+	c.mtx.Unlock()
+	defer func() {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		c.refreshing--
+		if c.refreshing == 0 {
+			c.pending = nil
+		}
+	}()
+	reply, err := c.manager.API("conference json_list")
+	if err != nil {
+		return err
+	}
+	var list []jsonConference
+	if reply = strings.TrimSpace(reply); strings.HasPrefix(reply, "[") { //no json is sent without conferences
+		if err := json.Unmarshal([]byte(reply), &list); err != nil {
+			return err
+		}
+	}
+	rooms := map[string]*conferenceRoom{}
+	for _, conf := range list {
+		r := &conferenceRoom{locked: conf.Locked, members: map[string]ConferenceMember{}}
+		for _, m := range conf.Members {
+			if m.Type == "recording_node" {
+				continue
+			}
+			id := strconv.Itoa(m.ID)
+			r.members[id] = ConferenceMember{ID: id, UUID: m.UUID, CallerIDName: m.CallerIDName,
+				CallerIDNumber: m.CallerIDNumber, Moderator: m.Flags.IsModerator, Muted: !m.Flags.CanSpeak,
+				Deaf: !m.Flags.CanHear, Talking: m.Flags.Talking}
+		}
+		rooms[conf.Name] = r
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.rooms = rooms
+	for _, e := range c.pending {
+		c.apply(e)
+	}
+	return nil
+}
+
+//api runs conference api command on room, replies of missing rooms or members are returned as fs.CommandError
+func (c *ConferenceController) api(room string, args ...string) (string, error) {
+	cmd := fmt.Sprintf("conference %s %s", room, strings.Join(args, " "))
+	reply, err := c.manager.API(cmd)
+	if err != nil {
+		return reply, err
+	}
+	if strings.Contains(reply, "not found") || strings.HasPrefix(reply, "Non-Existant ID") {
+		return reply, &fs.CommandError{Command: cmd, Reply: strings.TrimSpace(reply)}
+	}
+	return reply, nil
+}
+
+//Mute stops member from speaking in room
+func (c *ConferenceController) Mute(room string, member string) error {
+	_, err := c.api(room, "mute", member)
+	return err
+}
+
+//Unmute lets member speak in room
+func (c *ConferenceController) Unmute(room string, member string) error {
+	_, err := c.api(room, "unmute", member)
+	return err
+}
+
+//Deaf stops member from hearing room
+func (c *ConferenceController) Deaf(room string, member string) error {
+	_, err := c.api(room, "deaf", member)
+	return err
+}
+
+//Undeaf lets member hear room
+func (c *ConferenceController) Undeaf(room string, member string) error {
+	_, err := c.api(room, "undeaf", member)
+	return err
+}
+
+//Kick removes member from room, its conference application returns
+func (c *ConferenceController) Kick(room string, member string) error {
+	_, err := c.api(room, "kick", member)
+	return err
+}
+
+//Play plays file to member of room, or to whole room if member is empty
+func (c *ConferenceController) Play(room string, file string, member string) error {
+	args := []string{"play", quoteArg(file)}
+	if member != "" {
+		args = append(args, member)
+	}
+	_, err := c.api(room, args...)
+	return err
+}
+
+//StopPlay stops files playing in room
+func (c *ConferenceController) StopPlay(room string) error {
+	_, err := c.api(room, "stop", "all")
+	return err
+}
+
+//Record starts recording room to path
+func (c *ConferenceController) Record(room string, path string) error {
+	_, err := c.api(room, "recording", "start", quoteArg(path))
+	return err
+}
+
+//StopRecord stops recording room to path, all stops every recording of room
+func (c *ConferenceController) StopRecord(room string, path string) error {
+	_, err := c.api(room, "recording", "stop", quoteArg(path))
+	return err
+}
+
+//Lock stops new members from joining room
+func (c *ConferenceController) Lock(room string) error {
+	_, err := c.api(room, "lock")
+	return err
+}
+
+//Unlock lets new members join room
+func (c *ConferenceController) Unlock(room string) error {
+	_, err := c.api(room, "unlock")
+	return err
+}
@@ -0,0 +1,160 @@
+package eslsession_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+const conferenceList = `[{"conference_name":"3001","locked":true,"members":[` +
+	`{"type":"caller","id":2,"uuid":"u2","caller_id_number":"1002","flags":{"can_hear":true,"can_speak":false}},` +
+	`{"type":"recording_node","id":3,"flags":{}}]}]`
+
+func conferenceEvent(action string, member string, speak string) map[string]string {
+	return map[string]string{"Event-Subclass": eslsession.ConferenceSubclass, "Conference-Name": "3000",
+		"Action": action, "Member-ID": member, "Member-Type": "moderator", "Caller-Caller-ID-Number": "1000",
+		"Speak": speak, "Hear": "true"}
+}
+
+func TestConference(t *testing.T) {
+	s := newServer(t)
+	s.HandleExecute("conference", func(ch *esltest.Channel, cmd esltest.Command) {
+		ch.Event("CUSTOM", conferenceEvent("add-member", "7", "true"))
+	})
+	var mtx sync.Mutex
+	var apis []string
+	joined := make(chan struct{}, 1)
+	s.HandleAPI(func(cmd string) string {
+		mtx.Lock()
+		apis = append(apis, cmd)
+		mtx.Unlock()
+		switch {
+		case cmd == "conference json_list": //a member joins and is tracked before the list arrives
+			e := conferenceEvent("add-member", "9", "true")
+			e["Event-Name"], e["Conference-Name"] = "CUSTOM", "3001"
+			s.Event(e, "")
+			select {
+			case <-joined:
+			case <-time.After(5 * time.Second):
+			}
+			return conferenceList
+		case strings.HasPrefix(cmd, "conference 3000 "):
+			return "OK " + strings.TrimPrefix(cmd, "conference 3000 ")
+		}
+		return "Conference " + strings.Fields(cmd)[1] + " not found"
+	})
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+	c, err := eslsession.NewConferenceController(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan fs.IEvent, 4)
+	c.AddHandler("", func(e fs.IEvent) { events <- e })
+	c.AddHandler("add-member", func(e fs.IEvent) {
+		if e.GetHeader("Conference-Name") == "3001" {
+			joined <- struct{}{}
+		}
+	})
+
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			sess.Conference("3000", fs.ConferenceOptions{Profile: "wideband", PIN: "1234", Flags: []string{"moderator", "endconf"}})
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WaitCommand("event json CUSTOM conference::maniacs", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WaitCommand("event json HEARTBEAT", 0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	if cmd, err := ch.WaitExecute("conference", 0); err != nil || cmd.AppArg() != "3000@wideband+1234+flags{moderator|endconf}" {
+		t.Errorf("unexpected conference argument %q %v", cmd.AppArg(), err)
+	}
+	receive(t, events, "add-member")
+	if members := c.Members("3000"); len(members) != 1 || members[0].ID != "7" || members[0].UUID != ch.UUID ||
+		!members[0].Moderator || members[0].Muted {
+		t.Errorf("unexpected members %+v", members)
+	}
+
+	if err := c.Mute("3000", "7"); err != nil {
+		t.Fatal(err)
+	}
+	ch.Event("CUSTOM", conferenceEvent("mute-member", "7", "false"))
+	receive(t, events, "mute-member")
+	if member, ok := c.Member("3000", "7"); !ok || !member.Muted {
+		t.Errorf("member is not muted %+v", member)
+	}
+	ch.Event("CUSTOM", map[string]string{"Event-Subclass": eslsession.ConferenceSubclass, "Conference-Name": "3000", "Action": "lock"})
+	receive(t, events, "lock")
+	if !c.Locked("3000") {
+		t.Error("room is not locked")
+	}
+	ch.Event("CUSTOM", conferenceEvent("del-member", "7", "false"))
+	receive(t, events, "del-member")
+	if members := c.Members("3000"); len(members) != 0 {
+		t.Errorf("member is not removed %+v", members)
+	}
+
+	for _, op := range []func() error{
+		func() error { return c.Play("3000", "conference/conf-alone.wav", "") },
+		func() error { return c.Record("3000", "/tmp/room 3000.wav") },
+		func() error { return c.Kick("3000", "all") },
+	} {
+		if err := op(); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := c.Deaf("3002", "1"); !errors.Is(err, fs.ErrCommandRejected) {
+		t.Errorf("missing room is not an error: %v", err)
+	}
+
+	if err := c.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, events, "add-member")
+	if rooms := c.Rooms(); len(rooms) != 1 || rooms[0] != "3001" || !c.Locked("3001") {
+		t.Errorf("unexpected rooms %v", rooms)
+	}
+	if member, ok := c.Member("3001", "2"); !ok || member.CallerIDNumber != "1002" || !member.Muted {
+		t.Errorf("unexpected listed member %+v", member)
+	}
+	if _, ok := c.Member("3001", "9"); !ok || len(c.Members("3001")) != 2 {
+		t.Errorf("member joined during refresh is lost %+v", c.Members("3001"))
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	want := []string{"conference 3000 mute 7", "conference 3000 play conference/conf-alone.wav",
+		"conference 3000 recording start '/tmp/room 3000.wav'", "conference 3000 kick all", "conference 3002 deaf 1"}
+	for _, cmd := range want {
+		if !containsCommand(apis, cmd) {
+			t.Errorf("%s not sent in %v", cmd, apis)
+		}
+	}
+}
+
+func containsCommand(cmds []string, cmd string) bool {
+	for _, c := range cmds {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
@@ -1,13 +1,25 @@
 package eslsession
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
 	l "github.com/babakyakhchali/go-esl-wrapper/logger"
 	"github.com/google/uuid"
 )
 
+var (
+	//DefaultBreakCommand api used to stop an application whose context is cancelled, %s is channel uuid
+	DefaultBreakCommand = "uuid_break %s all"
+	//BreakCommands overrides DefaultBreakCommand per application name. uuid_break does not end a bridge,
+	//so its other leg is hung up instead
+	BreakCommands = map[string]string{
+		"bridge": "uuid_transfer %s -bleg hangup:ORIGINATOR_CANCEL inline",
+	}
+)
+
 //FsConnector acts as a channel between fs and session
 type FsConnector struct {
 	uuid string
@@ -23,65 +35,167 @@ type FsConnector struct {
 	execEvent chan fs.IEvent
 	execError chan error
 
-	jobEvent       chan fs.IEvent
-	jobError       chan error
+	jobEvent chan fs.IEvent
+	jobError chan error
+
+	//closed when channel is destroyed or connection fails, closeErr tells why
+	done     chan struct{}
+	closeErr error
+
+	//mtx guards fields shared by app goroutine and dispatcher
+	mtx            sync.Mutex
 	currentAppUUID string
+	currentJobUUID string
 	closed         bool
 	logger         *l.NsLogger
-	EventHandlers  map[string]fs.EventHandlerFunc
+	handlers       *handlerRegistry
+	waiters        []*eventWaiter
+	digits         *digitBuffer
+	//asyncHandlers runs handlers which are not HandleSync
+	asyncHandlers *handlerQueue
+}
 
-	currentJobUUID string
+func newFsConnector(uuid string, logger *l.NsLogger) *FsConnector {
+	return &FsConnector{
+		uuid:          uuid,
+		cmds:          make(chan map[string]string),
+		execError:     make(chan error),
+		execEvent:     make(chan fs.IEvent, 1),
+		jobEvent:      make(chan fs.IEvent, 1),
+		jobError:      make(chan error),
+		events:        make(chan fs.IEvent, 16),
+		errors:        make(chan error),
+		done:          make(chan struct{}),
+		closed:        false,
+		logger:        logger,
+		handlers:      newHandlerRegistry(),
+		asyncHandlers: newHandlerQueue(),
+		digits:        newDigitBuffer(),
+	}
 }
 
-func (fs *FsConnector) close() {
+//close marks connector closed and wakes up everything waiting on it, only first reason is kept
+func (fs *FsConnector) close(reason error) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	if fs.closed {
+		return
+	}
 	fs.closed = true
-	close(fs.cmds)
+	fs.closeErr = reason
+	close(fs.done)
+}
+
+//err returns reason of close or nil if still open
+func (fs *FsConnector) err() error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	return fs.closeErr
+}
+
+//Done is closed when channel is destroyed or connection is lost, Err tells why
+func (fs *FsConnector) Done() <-chan struct{} {
+	return fs.done
+}
+
+//Err returns why connector was closed, nil while channel is live
+func (fs *FsConnector) Err() error {
+	return fs.err()
+}
+
+//handle calls handlers of event, sync ones right away and others on async handler goroutine
+func (fs *FsConnector) handle(event fs.IEvent) {
+	for _, h := range fs.handlers.take(handlerNames(event)) {
+		if h.sync {
+			h.handler(event)
+			continue
+		}
+		handler := h.handler
+		fs.asyncHandlers.push(func() { handler(event) })
+	}
+}
+
+//deliver passes an event to dispatcher, it blocks only while dispatcher is alive
+func (fs *FsConnector) deliver(event fs.IEvent) bool {
+	select {
+	case fs.events <- event:
+		return true
+	case <-fs.done:
+		return false
+	}
 }
 
 //sits between event channel and session and receives all events and replies for the session
 func (fs *FsConnector) dispatch() {
+	go fs.asyncHandlers.run(fs.done)
 	for {
 		select {
 		case event := <-fs.events:
 			ename := event.GetHeader("Event-Name")
 			fs.logger.Debug("dispatch(): got event %s:%s", ename, fs.uuid)
-			euuid := event.GetHeader("Application-UUID")
-			if ename == "CHANNEL_EXECUTE_COMPLETE" && euuid == fs.currentAppUUID {
+			fs.mtx.Lock()
+			appUUID, jobUUID := fs.currentAppUUID, fs.currentJobUUID
+			fs.mtx.Unlock()
+			if ename == "CHANNEL_EXECUTE_COMPLETE" && DigitApplications[event.GetHeader("Application")] {
+				fs.digits.flush() //before exec returns so app can not read them
+			}
+			if ename == "CHANNEL_EXECUTE_COMPLETE" && event.GetHeader("Application-UUID") == appUUID {
 				select { //this must be nonblocking
 				case fs.execEvent <- event:
 				default:
 				}
 			}
-			if ename == "CHANNEL_DESTROY" {
-				fs.close()
+			if ename == "BACKGROUND_JOB" && event.GetHeader("Job-UUID") == jobUUID {
 				select { //this must be nonblocking
-				case fs.execError <- fmt.Errorf(EChannelClosed):
+				case fs.jobEvent <- event:
 				default:
 				}
+			}
+			if ename == "DTMF" {
+				fs.digits.push(event.GetHeader("DTMF-Digit"))
+			}
+			fs.notifyWaiters(event)
+			fs.handle(event) //async handlers queued before close are still run
+			if ename == "CHANNEL_DESTROY" {
+				fs.close(channelClosed(fs.uuid, event.GetHeader("Hangup-Cause")))
 				fs.logger.Debug("dispatch(): ended by CHANNEL_DESTROY")
 				return
 			}
-			if h, e := fs.EventHandlers[ename]; e {
-				go h(event)
-			}
 		case err := <-fs.errors: //inform blocked execs and bgapis
-			select {
-			case fs.execError <- err:
-			default:
-			}
-			select {
-			case fs.jobError <- err:
-			default:
-			}
-			fs.close()
+			fs.close(err)
 			fs.logger.Debug("dispatch(): ended by error:", err)
 			return
-
+		case <-fs.done:
+			return
 		}
 	}
 
 }
 
+//send passes a command to session loop
+func (fs *FsConnector) send(cmd map[string]string) error {
+	select {
+	case fs.cmds <- cmd:
+		return nil
+	case <-fs.done:
+		return fs.err()
+	}
+}
+
+//breakApp asks freeswitch to stop app running on channel, used when its context is cancelled
+func (fs *FsConnector) breakApp(app string) {
+	format, found := BreakCommands[app]
+	if !found {
+		format = DefaultBreakCommand
+	}
+	cmd := fmt.Sprintf(format, fs.uuid)
+	fs.logger.Debug("breaking %s using %s", app, cmd)
+	fs.send(map[string]string{
+		"bgapi":    cmd,
+		"Job-UUID": uuid.New().String(),
+	})
+}
+
 //Application-UUID Event-UUID
 //
 //this method handles complex logic because of the event based nature of the module
@@ -90,53 +204,110 @@ func (fs *FsConnector) dispatch() {
 // * already hangged up
 // * in the middle of hangup
 // * up and running
-func (fs *FsConnector) exec(app string, args string) (fs.IEvent, error) {
-	if fs.closed {
-		return nil, fmt.Errorf(EChannelClosed)
+//
+//if ctx is done before execution completes app is stopped and ctx.Err() is returned
+func (fs *FsConnector) execContext(ctx context.Context, app string, args string) (fs.IEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 	headers := make(map[string]string)
 	headers["call-command"] = "execute"
 	headers["execute-app-name"] = app
 	headers["execute-app-arg"] = args
 	headers["Event-UUID"] = uuid.New().String()
-	fs.currentAppUUID = headers["Event-UUID"]
+	appUUID := headers["Event-UUID"]
+
+	fs.mtx.Lock()
+	if fs.closed {
+		fs.mtx.Unlock()
+		return nil, fs.err()
+	}
+	fs.currentAppUUID = appUUID
+	fs.mtx.Unlock()
 
 	defer func() {
+		fs.mtx.Lock()
 		fs.currentAppUUID = ""
+		fs.mtx.Unlock()
 	}()
 
-	fs.cmds <- headers
-
-	select {
-	case event := <-fs.execEvent:
-		return event, nil
-	case err := <-fs.execError:
-		fs.logger.Debug("exec(%s,%s)(%s) error: %s", app, args, fs.currentAppUUID, err)
+	if err := fs.send(headers); err != nil {
 		return nil, err
 	}
+
+	for {
+		select {
+		case event := <-fs.execEvent:
+			if event.GetHeader("Application-UUID") == appUUID {
+				return event, nil
+			}
+		case err := <-fs.execError:
+			fs.logger.Debug("exec(%s,%s)(%s) error: %s", app, args, appUUID, err)
+			return nil, err
+		case <-ctx.Done():
+			fs.breakApp(app)
+			fs.logger.Debug("exec(%s,%s)(%s) cancelled: %s", app, args, appUUID, ctx.Err())
+			return nil, ctx.Err()
+		case <-fs.done:
+			select { //result may have arrived just before the channel was destroyed
+			case event := <-fs.execEvent:
+				if event.GetHeader("Application-UUID") == appUUID {
+					return event, nil
+				}
+			default:
+			}
+			err := fs.err()
+			fs.logger.Debug("exec(%s,%s)(%s) error: %s", app, args, appUUID, err)
+			return nil, err
+		}
+	}
 }
 
-func (fs *FsConnector) bgapi(cmd string) (fs.IEvent, error) {
-	if fs.closed {
-		return nil, fmt.Errorf(EChannelClosed)
+//bgapiContext waits for job result until ctx is done, the job itself keeps running in freeswitch
+func (fs *FsConnector) bgapiContext(ctx context.Context, cmd string) (fs.IEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 	headers := make(map[string]string)
 	headers["bgapi"] = cmd
 	headers["Job-UUID"] = uuid.New().String()
-	fs.currentJobUUID = headers["Job-UUID"]
+	jobUUID := headers["Job-UUID"]
+
+	fs.mtx.Lock()
+	if fs.closed {
+		fs.mtx.Unlock()
+		return nil, fs.err()
+	}
+	fs.currentJobUUID = jobUUID
+	fs.mtx.Unlock()
 
 	defer func() {
+		fs.mtx.Lock()
 		fs.currentJobUUID = ""
+		fs.mtx.Unlock()
 	}()
 
-	fs.cmds <- headers
-
-	select {
-	case event := <-fs.jobEvent:
-		fs.logger.Debug("bgapi(%s) => %s", cmd, event.GetBody())
-		return event, nil
-	case err := <-fs.jobError:
-		fs.logger.Debug("bgapi(%s) error: %s", cmd, err)
+	if err := fs.send(headers); err != nil {
 		return nil, err
 	}
+
+	for {
+		select {
+		case event := <-fs.jobEvent:
+			if event.GetHeader("Job-UUID") != jobUUID {
+				continue
+			}
+			fs.logger.Debug("bgapi(%s) => %s", cmd, event.GetBody())
+			return event, nil
+		case err := <-fs.jobError:
+			fs.logger.Debug("bgapi(%s) error: %s", cmd, err)
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-fs.done:
+			err := fs.err()
+			fs.logger.Debug("bgapi(%s) error: %s", cmd, err)
+			return nil, err
+		}
+	}
 }
@@ -0,0 +1,66 @@
+package eslsession_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+func TestCancelBridge(t *testing.T) {
+	s := newServer(t)
+	bridges := make(chan esltest.Command, 1)
+	s.HandleExecute("bridge", func(ch *esltest.Channel, cmd esltest.Command) { bridges <- cmd }) //bridged until b-leg leaves
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			if _, err := sess.ExecContext(ctx, "bridge", "user/1001"); err != context.Canceled {
+				errs <- err
+				return
+			}
+			_, err := sess.Playback("goodbye.wav")
+			errs <- err
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	var bridge esltest.Command
+	select {
+	case bridge = <-bridges:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge did not start")
+	}
+	cancel()
+	if _, err := s.WaitCommand("bgapi uuid_transfer "+ch.UUID+" -bleg hangup:ORIGINATOR_CANCEL inline", 0); err != nil {
+		t.Fatal(err)
+	}
+	ch.CompleteExecute(bridge, map[string]string{"variable_originate_disposition": "ORIGINATOR_CANCEL"}) //b-leg hung up
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not continue after bridge was cancelled")
+	}
+	if apps := ch.Apps(); len(apps) != 2 || apps[1] != "playback" {
+		t.Errorf("unexpected apps %v", apps)
+	}
+}
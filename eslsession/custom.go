@@ -0,0 +1,72 @@
+package eslsession
+
+import (
+	"strings"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//splitEvents splits subscription arguments to event names and subclasses, every argument following CUSTOM
+//is a subclass like in freeswitch event command
+func splitEvents(events []string) (names []string, subclasses []string) {
+	custom := false
+	for _, e := range events {
+		for _, f := range strings.Fields(e) {
+			if custom {
+				subclasses = append(subclasses, f)
+			} else if f == "CUSTOM" {
+				custom = true
+			} else {
+				names = append(names, f)
+			}
+		}
+	}
+	return names, subclasses
+}
+
+//joinEvents is reverse of splitEvents
+func joinEvents(names []string, subclasses []string) []string {
+	events := append([]string(nil), names...)
+	if len(subclasses) > 0 {
+		events = append(events, "CUSTOM")
+		events = append(events, subclasses...)
+	}
+	return events
+}
+
+//handlerNames returns names handlers of event are looked up by, most specific first
+func handlerNames(e fs.IEvent) []string {
+	name := e.GetHeader("Event-Name")
+	if name == "CUSTOM" {
+		if subclass := e.GetHeader("Event-Subclass"); subclass != "" {
+			return []string{fs.CustomEventName(subclass), name}
+		}
+	}
+	return []string{name}
+}
+
+//SubscribeCustom subscribes CUSTOM events of subclasses, e.g. conference::maniacs or sofia::register.
+//Events of a channel are delivered to its session, see ISession.AddCustomEventHandler
+func (m *SessionManager) SubscribeCustom(subclasses ...string) error {
+	if len(subclasses) == 0 {
+		return nil
+	}
+	return m.Subscribe(append([]string{"CUSTOM"}, subclasses...)...)
+}
+
+//AddCustomEventHandler subscribes CUSTOM events of subclass and adds a global handler of them,
+//see AddGlobalEventHandler
+func (m *SessionManager) AddCustomEventHandler(subclass string, handler fs.EventHandlerFunc) error {
+	m.AddGlobalEventHandler(fs.CustomEventName(subclass), handler)
+	return m.SubscribeCustom(subclass)
+}
+
+//AddCustomEventHandler subscribes CUSTOM events of subclass on session's connection and adds a handler of
+//those belonging to managed channel. Same as AddEventHandler(fs.CustomEventName(subclass), handler) after
+//SessionManager.SubscribeCustom(subclass)
+func (s *Session) AddCustomEventHandler(subclass string, handler fs.EventHandlerFunc, options ...fs.HandlerOption) (fs.IEventHandle, error) {
+	if err := s.manager.SubscribeCustom(subclass); err != nil {
+		return nil, err
+	}
+	return s.AddEventHandler(fs.CustomEventName(subclass), handler, options...), nil
+}
@@ -0,0 +1,92 @@
+package eslsession_test
+
+import (
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+//runApp runs itself on every parked channel
+type runApp func()
+
+func (app runApp) IsApplicable(fs.IEvent) bool { return true }
+func (app runApp) Setup(fs.IEvent)             {}
+func (app runApp) Run()                        { app() }
+
+func receive(t *testing.T, events chan fs.IEvent, what string) fs.IEvent {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s not received", what)
+	}
+	return nil
+}
+
+func TestCustomEvents(t *testing.T) {
+	s := newServer(t)
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	registers := make(chan fs.IEvent, 4)
+	if err := m.AddCustomEventHandler("sofia::register", func(e fs.IEvent) { registers <- e }); err != nil {
+		t.Fatal(err)
+	}
+	notifies := make(chan fs.IEvent, 4)
+	added := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			_, err := sess.AddCustomEventHandler("VoiceWorks.pl::ACDnotify", func(e fs.IEvent) { notifies <- e })
+			added <- err
+			<-done
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WaitCommand("event json HEARTBEAT", 0); err != nil { //custom events were subscribed before Serve
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not run")
+	}
+	if _, err := s.WaitCommand("event json CUSTOM VoiceWorks.pl::ACDnotify", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	ch.Event("CUSTOM", map[string]string{"Event-Subclass": "conference::maniacs"}) //not subscribed
+	ch.Event("CUSTOM", map[string]string{"Event-Subclass": "VoiceWorks.pl::ACDnotify", "state": "Intro"})
+	if e := receive(t, notifies, "session custom event"); e.GetHeader("state") != "Intro" {
+		t.Errorf("unexpected event %s", e.GetHeader("Event-Subclass"))
+	}
+	s.Event(map[string]string{"Event-Name": "CUSTOM", "Event-Subclass": "sofia::register", "username": "1000"}, "")
+	if e := receive(t, registers, "global custom event"); e.GetHeader("username") != "1000" {
+		t.Errorf("unexpected register event %v", e.GetHeader("username"))
+	}
+	select {
+	case e := <-notifies:
+		t.Errorf("unexpected event %s", e.GetHeader("Event-Subclass"))
+	default:
+	}
+	if events := m.Events(); events[len(events)-3] != "CUSTOM" {
+		t.Errorf("custom subclasses not tracked: %v", events)
+	}
+}
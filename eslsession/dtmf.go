@@ -0,0 +1,117 @@
+package eslsession
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+//DigitBufferSize is how many DTMF digits a session keeps until they are read, oldest digits are dropped
+var DigitBufferSize = 64
+
+//DigitApplications collect DTMF themselves, digits buffered while they run are dropped once they complete
+//so ReadDigit does not return digits they consumed
+var DigitApplications = map[string]bool{"play_and_get_digits": true, "read": true}
+
+//digitBuffer keeps DTMF digits of a channel received by dispatcher until the app reads them
+type digitBuffer struct {
+	mtx     sync.Mutex
+	digits  []string
+	changed chan struct{} //closed and replaced when a digit is pushed
+}
+
+func newDigitBuffer() *digitBuffer {
+	return &digitBuffer{changed: make(chan struct{})}
+}
+
+func (b *digitBuffer) push(digit string) {
+	if digit == "" {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.digits = append(b.digits, digit)
+	if over := len(b.digits) - DigitBufferSize; over > 0 {
+		b.digits = b.digits[over:]
+	}
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+//pop returns oldest digit or a channel closed when one is pushed
+func (b *digitBuffer) pop() (string, chan struct{}) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if len(b.digits) == 0 {
+		return "", b.changed
+	}
+	d := b.digits[0]
+	b.digits = b.digits[1:]
+	return d, nil
+}
+
+func (b *digitBuffer) flush() string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	digits := strings.Join(b.digits, "")
+	b.digits = nil
+	return digits
+}
+
+//ReadDigit returns next DTMF digit of channel, waiting up to timeout for it (0 waits without timeout).
+//Digits are buffered from session start, also while other applications like playback or bridge run,
+//so a digit pressed before the call is returned right away. Digits collected by DigitApplications are not
+//returned. Returns "" on timeout.
+//Buffered digits are returned even after channel is destroyed, then its error is returned
+func (s *Session) ReadDigit(timeout time.Duration) (string, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ctx := s.Context()
+	for {
+		d, changed := s.digits.pop()
+		if d != "" {
+			return d, nil
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return "", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-s.done:
+			if d, _ := s.digits.pop(); d != "" {
+				return d, nil
+			}
+			return "", s.err()
+		}
+	}
+}
+
+//ReadDigits reads up to max digits (0 for no limit) until one of terminators is pressed, timeout passes
+//before first digit or interDigitTimeout passes between digits. Terminator is not included in result.
+//A timeout ends reading without error, so result may be shorter than max or empty
+func (s *Session) ReadDigits(max int, terminators string, timeout time.Duration, interDigitTimeout time.Duration) (string, error) {
+	var digits strings.Builder
+	wait := timeout
+	for max <= 0 || digits.Len() < max {
+		d, err := s.ReadDigit(wait)
+		if err != nil || d == "" {
+			return digits.String(), err
+		}
+		if strings.Contains(terminators, d) {
+			break
+		}
+		digits.WriteString(d)
+		wait = interDigitTimeout
+	}
+	return digits.String(), nil
+}
+
+//FlushDigits drops buffered digits and returns them, e.g. before a prompt which must not be answered ahead
+func (s *Session) FlushDigits() string {
+	return s.digits.flush()
+}
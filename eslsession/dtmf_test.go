@@ -0,0 +1,128 @@
+package eslsession_test
+
+import (
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+func TestReadDigits(t *testing.T) {
+	s := newServer(t)
+	s.HandleExecute("playback", func(ch *esltest.Channel, cmd esltest.Command) {}) //plays until hangup
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	results := make(chan string, 4)
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			go sess.Playback("music.wav")
+			pin, _ := sess.ReadDigits(4, "#", 5*time.Second, time.Second)
+			results <- pin
+			d, _ := sess.ReadDigit(50 * time.Millisecond)
+			results <- "timeout:" + d
+			code, _ := sess.ReadDigits(0, "", 5*time.Second, 100*time.Millisecond)
+			results <- code
+			sess.WaitForEvent(5*time.Second, "CHANNEL_HANGUP")
+			results <- sess.FlushDigits()
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	if _, err := ch.WaitExecute("playback", 0); err != nil {
+		t.Fatal(err)
+	}
+	press := func(digits ...string) {
+		for _, d := range digits {
+			ch.Event("DTMF", map[string]string{"DTMF-Digit": d})
+		}
+	}
+	next := func() string {
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("digits not read")
+		}
+		return ""
+	}
+
+	press("1", "2", "3", "#")
+	if pin := next(); pin != "123" {
+		t.Errorf("expected 123 terminated by #, got %q", pin)
+	}
+	if d := next(); d != "timeout:" {
+		t.Errorf("expected digit timeout, got %q", d)
+	}
+	press("9", "8", "7")
+	if code := next(); code != "987" {
+		t.Errorf("expected 987 ended by inter digit timeout, got %q", code)
+	}
+	press("4", "2")
+	ch.Hangup("NORMAL_CLEARING")
+	if flushed := next(); flushed != "42" {
+		t.Errorf("expected 42 flushed, got %q", flushed)
+	}
+}
+
+func TestReadDigitAfterGetDigits(t *testing.T) {
+	s := newServer(t)
+	s.HandleExecute("play_and_get_digits", func(ch *esltest.Channel, cmd esltest.Command) {
+		for _, d := range []string{"1", "2", "#"} {
+			ch.Event("DTMF", map[string]string{"DTMF-Digit": d})
+		}
+		ch.CompleteExecute(cmd, map[string]string{"variable_" + digitsVar.FindString(cmd.AppArg()): "12"})
+	})
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	results := make(chan string, 2)
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			r, err := sess.GetDigits(fs.GetDigitsOptions{Max: 4, Prompt: "ivr/menu.wav"})
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- r.Digits
+			d, _ := sess.ReadDigit(5 * time.Second)
+			results <- d
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	next := func() string {
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("digits not read")
+		}
+		return ""
+	}
+	if digits := next(); digits != "12" {
+		t.Fatalf("unexpected collected digits %q", digits)
+	}
+	ch.Event("DTMF", map[string]string{"DTMF-Digit": "5"})
+	if d := next(); d != "5" {
+		t.Errorf("expected digit pressed after play_and_get_digits, got %q", d)
+	}
+}
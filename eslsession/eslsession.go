@@ -1,9 +1,12 @@
 package eslsession
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
@@ -12,12 +15,11 @@ import (
 )
 
 var (
-	sessions      = map[string]*Session{}
-	bgapi2Session = make(map[string]string) //relates background job events to sessions
-
 	sessionLogger = l.NewLogger("eslsession")
-	client        fs.IEsl
-	bgApiJobs     = make(map[string]bgAPICtx)
+
+	managerCount      uint64
+	defaultManager    *SessionManager //manager created by last EslConnectionHandler call
+	defaultManagerMtx sync.Mutex
 )
 
 //SetLogLevel set loglevel for eslsession logger
@@ -25,14 +27,73 @@ func SetLogLevel(l int) {
 	sessionLogger.SetLevel(l)
 }
 
+var (
+	//DefaultEvents events subscribed by SessionManager
+	DefaultEvents = []string{"HEARTBEAT", "CHANNEL_HANGUP", "CHANNEL_EXECUTE", "CHANNEL_EXECUTE_COMPLETE", "CHANNEL_PARK",
+		"CHANNEL_DESTROY", "CHANNEL_ANSWER", "CHANNEL_BRIDGE", "CHANNEL_UNBRIDGE", "BACKGROUND_JOB", "DTMF"}
+	//DefaultEventFormat format of events subscribed by new managers
+	DefaultEventFormat = EventFormatJSON
+)
+
+//event formats accepted by SetEventFormat
+const (
+	EventFormatJSON  = "json"
+	EventFormatPlain = "plain"
+	EventFormatXML   = "xml"
+)
+
 var (
 	//EChannelClosed occurs when exec is called on a channel which already is destroyed by hangup
+	//
+	//Deprecated: errors are *fs.ChannelClosedError now, check them with errors.Is(err, fs.ErrChannelClosed)
 	EChannelClosed = "ChannelHangup"
 )
 
-//SessionManager manages sessions
+//channelClosed creates error returned by operations of a destroyed channel
+func channelClosed(uuid string, hangupCause string) error {
+	return &fs.ChannelClosedError{UUID: uuid, HangupCause: hangupCause}
+}
+
+//SessionManager manages sessions and background jobs of one esl connection.
+//Several managers can be used in one process, each with its own client
+//
+//Registries are safe for concurrent use, see registry.go for who adds and removes entries
 type SessionManager struct {
-	sessions map[string]*Session
+	client fs.IEsl
+	//clientMtx is held for writing while client reconnects
+	clientMtx       sync.RWMutex
+	reconnectPolicy *ReconnectPolicy
+	//outbound is set when connection was accepted from freeswitch socket application
+	outbound    bool
+	eventFormat string
+	//events and subclasses of CUSTOM events are subscribed by Serve, Subscribe adds to them
+	events     []string
+	subclasses []string
+	eventsMtx  sync.Mutex
+	sessions   *sessionRegistry
+	jobs       *jobRegistry
+	originates *originateRegistry
+	globals    *globalHandlers
+	logger     *l.NsLogger
+
+	//flowStatuses are states of flows running on sessions of manager by channel uuid
+	flowStatuses    map[string]FlowStatus
+	flowStatusesMtx sync.RWMutex
+}
+
+//NewSessionManager creates a manager over an esl connection
+func NewSessionManager(c fs.IEsl) *SessionManager {
+	id := atomic.AddUint64(&managerCount, 1)
+	return &SessionManager{
+		client:      c,
+		eventFormat: DefaultEventFormat,
+		events:      append([]string(nil), DefaultEvents...),
+		sessions:    newSessionRegistry(),
+		jobs:        newJobRegistry(),
+		originates:  newOriginateRegistry(),
+		globals:     newGlobalHandlers(),
+		logger:      sessionLogger.CreateChild(fmt.Sprintf("conn-%d", id)),
+	}
 }
 
 //IEslApp all call handler apps must implement this
@@ -45,53 +106,55 @@ type IEslApp interface {
 //EslAppFactory signature for applications using this module
 type EslAppFactory func(s fs.ISession) IEslApp
 
-func eslSessionHandler(msg fs.IEvent, f EslAppFactory) {
-	s := Session{
-		FsConnector: FsConnector{
-			uuid:          msg.GetHeader("Unique-ID"),
-			cmds:          make(chan map[string]string),
-			execError:     make(chan error),
-			execEvent:     make(chan fs.IEvent),
-			jobEvent:      make(chan fs.IEvent),
-			jobError:      make(chan error),
-			events:        make(chan fs.IEvent),
-			errors:        make(chan error),
-			closed:        false,
-			EventHandlers: make(map[string]fs.EventHandlerFunc),
-		},
-	}
-	s.logger = sessionLogger.CreateChild(msg.GetHeader("Unique-ID"))
-	sessions[s.uuid] = &s
-	app := f(&s)
+func (m *SessionManager) newSession(msg fs.IEvent) *Session {
+	uuid := msg.GetHeader("Unique-ID")
+	return &Session{
+		FsConnector: newFsConnector(uuid, m.logger.CreateChild(uuid)),
+		manager:     m,
+	}
+}
+
+//eslSessionHandler runs app on an already registered session and serves its commands until channel is gone
+func (m *SessionManager) eslSessionHandler(s *Session, msg fs.IEvent, f EslAppFactory) {
+	go s.dispatch()
+	app := f(s)
 	if !app.IsApplicable((msg)) {
 		s.logger.Error("session not applicable:%s", s.uuid)
+		s.close(fmt.Errorf("session not applicable"))
+		if m.outbound { //let freeswitch continue dialplan
+			m.send("exit")
+		}
 		return
 	}
 	app.Setup(msg)
-	go s.dispatch()
 	go app.Run()
-	//TODO: clean this shiiiit
 	for {
-
-		cmd, more := <-s.cmds
-		if !more {
-			break
+		var cmd map[string]string
+		select {
+		case cmd = <-s.cmds:
+		case <-s.done:
+			s.logger.Info("session ended:%s", s.uuid)
+			return
 		}
 		if bgapi, isapi := cmd["bgapi"]; isapi {
-			bgapi2Session[cmd["Job-UUID"]] = s.uuid
-			err := client.BgAPI(bgapi, cmd["Job-UUID"])
+			m.jobs.addSessionJob(cmd["Job-UUID"], s.uuid)
+			err := m.bgAPI(bgapi, cmd["Job-UUID"])
 			if err != nil {
-				s.jobError <- err
+				select {
+				case s.jobError <- err:
+				case <-s.done:
+				}
 			}
 		} else {
-			err := client.SendMsg(cmd, s.uuid, "")
+			err := m.sendMsg(cmd, s.uuid)
 			if err != nil {
-				s.execError <- err
+				select {
+				case s.execError <- err:
+				case <-s.done:
+				}
 			}
 		}
-
 	}
-	s.logger.Info("session ended:%s", s.uuid)
 }
 
 type bgAPICtx struct {
@@ -102,58 +165,153 @@ type bgAPICtx struct {
 }
 
 //BgAPI run an api using bgapi and wait for result
-func BgAPI(api string, timout int) (string, error) {
+func (m *SessionManager) BgAPI(api string, timout int) (string, error) {
 	ctx := bgAPICtx{
 		result:        "",
 		errorChannel:  make(chan error, 1),
 		resultChannel: make(chan string, 1),
 		jobUUID:       uuid.New().String(),
 	}
-	to := make(chan bool, 1)
-	go func() {
-		time.Sleep(time.Duration(timout) * time.Second)
-		to <- true
-	}()
+	m.jobs.addWaiter(ctx)
+	defer m.jobs.removeWaiter(ctx.jobUUID)
 
-	defer delete(bgApiJobs, ctx.jobUUID)
-
-	bgApiJobs[ctx.jobUUID] = ctx
-	client.BgAPI(api, ctx.jobUUID)
+	if err := m.bgAPI(api, ctx.jobUUID); err != nil {
+		return "", err
+	}
 	select {
 	case r := <-ctx.resultChannel:
 		return r, nil
 	case err := <-ctx.errorChannel:
 		return "", err
-	case _ = <-to:
-		return "", fmt.Errorf("timeout")
+	case <-time.After(time.Duration(timout) * time.Second):
+		return "", &fs.TimeoutError{Op: "bgapi " + api, Timeout: time.Duration(timout) * time.Second}
 	}
 }
 
-//EslPropagateError sends error to waiting sessions or bgapi
-func EslPropagateError(e error) {
-	for _, v := range sessions {
-		v.errors <- e
+//API runs an api command on connection and blocks until its response.
+//It must not be called from the goroutine running Serve, events must keep being read for the response to arrive
+func (m *SessionManager) API(cmd string) (string, error) {
+	m.clientMtx.RLock()
+	defer m.clientMtx.RUnlock()
+	return m.client.API(cmd)
+}
+
+func (m *SessionManager) bgAPI(cmd string, jobUUID string) error {
+	m.clientMtx.RLock()
+	defer m.clientMtx.RUnlock()
+	return m.client.BgAPI(cmd, jobUUID)
+}
+
+func (m *SessionManager) sendMsg(cmd map[string]string, uuid string) error {
+	m.clientMtx.RLock()
+	defer m.clientMtx.RUnlock()
+	return m.client.SendMsg(cmd, uuid, "")
+}
+
+func (m *SessionManager) send(cmd string) error {
+	m.clientMtx.RLock()
+	defer m.clientMtx.RUnlock()
+	return m.client.Send(cmd)
+}
+
+func (m *SessionManager) subscribe() error {
+	return m.subscribeEvents(m.Events())
+}
+
+//subscribeEvents uses typed subscription of clients implementing fs.IEventSubscriber, raw events command otherwise
+func (m *SessionManager) subscribeEvents(events []string) error {
+	m.clientMtx.RLock()
+	defer m.clientMtx.RUnlock()
+	if sub, ok := m.client.(fs.IEventSubscriber); ok {
+		return sub.Events(m.eventFormat, events...)
 	}
-	for _, v := range bgApiJobs {
-		v.errorChannel <- e
+	return m.client.Send("events " + m.eventFormat + " " + strings.Join(events, " "))
+}
+
+//Subscribe adds events to those subscribed by manager (DefaultEvents), they are subscribed right away
+//and again after reconnecting. Handlers set by ISession.AddEventHandler receive them.
+//Like freeswitch every event following CUSTOM is a subclass, see SubscribeCustom.
+//Like API it waits for the reply so it must not be called from the goroutine running Serve
+func (m *SessionManager) Subscribe(events ...string) error {
+	names, subclasses := splitEvents(events)
+	if len(names) == 0 && len(subclasses) == 0 {
+		return nil
+	}
+	m.eventsMtx.Lock()
+	names, subclasses = missing(m.events, names), missing(m.subclasses, subclasses)
+	m.events = append(m.events, names...)
+	m.subclasses = append(m.subclasses, subclasses...)
+	m.eventsMtx.Unlock()
+	if len(names) == 0 && len(subclasses) == 0 { //already subscribed
+		return nil
 	}
+	return m.subscribeEvents(joinEvents(names, subclasses))
+}
+
+//Events returns events subscribed by manager, subclasses of CUSTOM events follow CUSTOM
+func (m *SessionManager) Events() []string {
+	m.eventsMtx.Lock()
+	defer m.eventsMtx.Unlock()
+	return joinEvents(m.events, m.subclasses)
 }
 
-//EslConnectionHandler listens for channel events. On receiving a park event creates a Session and runs
+//SetEventFormat selects format of subscribed events, one of EventFormatJSON, EventFormatPlain or
+//EventFormatXML. Must be called before Serve
+func (m *SessionManager) SetEventFormat(format string) error {
+	switch format {
+	case EventFormatJSON, EventFormatPlain, EventFormatXML:
+		m.eventFormat = format
+		return nil
+	}
+	return fmt.Errorf("unknown event format %s", format)
+}
+
+//PropagateError sends error to waiting sessions or bgapi of this manager
+func (m *SessionManager) PropagateError(e error) {
+	for _, v := range m.sessions.snapshot() {
+		select {
+		case v.errors <- e:
+		case <-v.done:
+		}
+	}
+	for _, v := range m.jobs.waitersSnapshot() {
+		select {
+		case v.errorChannel <- e:
+		default:
+		}
+	}
+}
+
+//Serve listens for channel events. On receiving a park event creates a Session and runs
 //the app created by factory in a new go routine
-func EslConnectionHandler(c fs.IEsl, factory EslAppFactory) error {
-	client = c
-	client.Send("events json HEARTBEAT CHANNEL_HANGUP CHANNEL_EXECUTE CHANNEL_EXECUTE_COMPLETE CHANNEL_PARK CHANNEL_DESTROY CHANNEL_ANSWER CHANNEL_BRIDGE CHANNEL_UNBRIDGE BACKGROUND_JOB")
+func (m *SessionManager) Serve(factory EslAppFactory) error {
+	go func() { //events of earlier subscriptions must be read by serve while subscribing waits for its reply
+		if err := m.subscribe(); err != nil {
+			m.logger.Error("Error subscribing events: %s", err)
+		}
+	}()
+	return m.serve(factory)
+}
+
+func (m *SessionManager) serve(factory EslAppFactory) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go m.globals.run(stop)
 	for {
-		sessionLogger.Debug("Ready for event session:%d status: %d routines, %s", len(sessions), runtime.NumGoroutine(), getMemStats())
-		msg, err := client.ReadMessage()
+		m.logger.Debug("Ready for event session:%d status: %d routines, %s", m.sessions.count(), runtime.NumGoroutine(), getMemStats())
+		msg, err := m.client.ReadMessage()
 		if err != nil {
-			sessionLogger.Error("Error %s", err)
-			//TODO: handle reconnects, if reconnect succeeds may be channels can continue
-			// If it contains EOF, we really dont care...
-			if !strings.Contains(err.Error(), "EOF") && err.Error() != "unexpected end of JSON input" {
-				sessionLogger.Error("Error while reading Freeswitch message: %s", err)
+			m.logger.Error("Error %s", err)
+			if m.reconnectPolicy != nil {
+				if rerr := m.reconnect(err); rerr == nil {
+					continue
+				}
 			}
+			// If connection is just closed, we really dont care...
+			if !errors.Is(err, fs.ErrConnectionLost) {
+				m.logger.Error("Error while reading Freeswitch message: %s", err)
+			}
+			m.PropagateError(err)
 			return err
 		}
 		eventName := msg.GetHeader("Event-Name")
@@ -161,46 +319,93 @@ func EslConnectionHandler(c fs.IEsl, factory EslAppFactory) error {
 		channelUUID := msg.GetHeader("Unique-ID")
 		if eventName == "BACKGROUND_JOB" { //try to find session which created the job
 			jobUUID := msg.GetHeader("Job-UUID")
-			if jobSessionUUID, found := bgapi2Session[jobUUID]; found {
+			jobSessionUUID, jobCTX := m.jobs.finish(jobUUID) //job finished so remove it
+			if jobSessionUUID != "" {
 				channelUUID = jobSessionUUID
-				delete(bgapi2Session, jobUUID) //job finished so remove it
 			}
-			if jobCTX, found := bgApiJobs[jobUUID]; found {
-				jobCTX.resultChannel <- string(msg.GetBody())
+			if jobCTX != nil {
+				select {
+				case jobCTX.resultChannel <- string(msg.GetBody()):
+				default:
+				}
 			}
 		}
-		if msg.GetType() != "text/event-json" {
-			sessionLogger.Debug("got %s: reply:%s body:%s ", msg.GetType(), msg.GetHeader("Reply-Text"), msg.GetBody())
+		if !strings.HasPrefix(msg.GetType(), "text/event-") {
+			m.logger.Debug("got %s: reply:%s body:%s ", msg.GetType(), msg.GetHeader("Reply-Text"), msg.GetBody())
 		} else {
-			sessionLogger.Debug("got event:%s(%s) uuid:%s", eventName, eventSubclass, channelUUID)
+			m.logger.Debug("got event:%s(%s) uuid:%s", eventName, eventSubclass, channelUUID)
 		}
 
 		if eventName == "CHANNEL_PARK" {
-			if _, isAlreadyHandled := sessions[channelUUID]; isAlreadyHandled == false {
-				go eslSessionHandler(msg, factory)
+			f := factory
+			if of, found := m.originates.take(channelUUID); found {
+				f = of
+			}
+			if s := m.newSession(msg); m.sessions.add(s) {
+				go m.eslSessionHandler(s, msg, f)
+				m.publish(msg, true)
 				continue
 			}
 		}
+		if eventName == "CHANNEL_DESTROY" {
+			m.originates.remove(channelUUID)
+		}
+		managed := false
 		if eventName == "HEARTBEAT" {
-			sessionLogger.Debug("HEARTBEAT: cps:%s , %s", msg.GetHeader("Session-Per-Sec"), msg.GetHeader("Up-Time"))
+			m.logger.Debug("HEARTBEAT: cps:%s , %s", msg.GetHeader("Session-Per-Sec"), msg.GetHeader("Up-Time"))
 		} else if channelUUID != "" {
-			s, r := sessions[channelUUID]
+			s, r := m.sessions.get(channelUUID)
 			if r {
-				select {
-				case s.events <- msg:
-					sessionLogger.Debug("handled event %s for channel %s", msg.GetHeader("Event-Name"), msg.GetHeader("Unique-ID"))
-				default:
-					sessionLogger.Debug("ignoring event %s for channel %s", msg.GetHeader("Event-Name"), msg.GetHeader("Unique-ID"))
+				managed = true
+				if s.deliver(msg) {
+					m.logger.Debug("handled event %s for channel %s", msg.GetHeader("Event-Name"), msg.GetHeader("Unique-ID"))
+				} else {
+					m.logger.Debug("ignoring event %s for channel %s", msg.GetHeader("Event-Name"), msg.GetHeader("Unique-ID"))
 				}
 				if eventName == "CHANNEL_DESTROY" {
-					delete(sessions, channelUUID)
-					sessionLogger.Debug("deleted channel %s. remained channels:%d", channelUUID, len(sessions))
+					m.sessions.remove(channelUUID)
+					m.logger.Debug("deleted channel %s. remained channels:%d", channelUUID, m.sessions.count())
 				}
 			}
 		}
+		if eventName != "" {
+			m.publish(msg, managed)
+		}
 	}
 
 	/*uncomment following lines to debug active goroutines on exit
-	sessionLogger.Debug("all routines stackl %s", dumpAllRoutines())
+	m.logger.Debug("all routines stackl %s", dumpAllRoutines())
 	*/
 }
+
+//BgAPI run an api using bgapi on the connection of last EslConnectionHandler call and wait for result
+func BgAPI(api string, timout int) (string, error) {
+	m := getDefaultManager()
+	if m == nil {
+		return "", fmt.Errorf("no esl connection: %w", fs.ErrConnectionLost)
+	}
+	return m.BgAPI(api, timout)
+}
+
+//EslPropagateError sends error to waiting sessions or bgapi of last EslConnectionHandler call
+func EslPropagateError(e error) {
+	if m := getDefaultManager(); m != nil {
+		m.PropagateError(e)
+	}
+}
+
+//EslConnectionHandler creates a SessionManager for connection and serves it.
+//Use NewSessionManager directly when handling more than one connection
+func EslConnectionHandler(c fs.IEsl, factory EslAppFactory) error {
+	m := NewSessionManager(c)
+	defaultManagerMtx.Lock()
+	defaultManager = m
+	defaultManagerMtx.Unlock()
+	return m.Serve(factory)
+}
+
+func getDefaultManager() *SessionManager {
+	defaultManagerMtx.Lock()
+	defer defaultManagerMtx.Unlock()
+	return defaultManager
+}
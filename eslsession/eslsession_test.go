@@ -0,0 +1,215 @@
+package eslsession
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+type fakeEvent map[string]string
+
+func (e fakeEvent) GetHeader(name string) string { return e[name] }
+func (e fakeEvent) GetBody() []byte              { return []byte(e["_body"]) }
+func (e fakeEvent) GetType() string              { return "text/event-json" }
+func (e fakeEvent) GetHeaderValues(name string) []string {
+	if v, found := e[name]; found {
+		return []string{v}
+	}
+	return nil
+}
+
+//fakeEsl answers every execute with CHANNEL_EXECUTE_COMPLETE and every bgapi with BACKGROUND_JOB
+type fakeEsl struct {
+	events chan fs.IEvent
+	closed chan struct{}
+	once   sync.Once
+	mtx    sync.Mutex
+}
+
+func newFakeEsl() *fakeEsl {
+	return &fakeEsl{
+		events: make(chan fs.IEvent, 1024),
+		closed: make(chan struct{}),
+	}
+}
+
+//push queues events back to back so nothing else can get between them
+func (f *fakeEsl) push(events ...fakeEvent) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for _, e := range events {
+		select {
+		case f.events <- e:
+		case <-f.closed:
+		}
+	}
+}
+
+func (f *fakeEsl) Send(cmd string) error { return nil }
+
+func (f *fakeEsl) SendMsg(cmd map[string]string, uuid string, data string) error {
+	go f.push(fakeEvent{
+		"Event-Name":       "CHANNEL_EXECUTE_COMPLETE",
+		"Unique-ID":        uuid,
+		"Application":      cmd["execute-app-name"],
+		"Application-UUID": cmd["Event-UUID"],
+	})
+	return nil
+}
+
+func (f *fakeEsl) BgAPI(cmd string, uuid string) error {
+	go f.push(fakeEvent{"Event-Name": "BACKGROUND_JOB", "Job-UUID": uuid, "_body": "+OK " + cmd})
+	return nil
+}
+
+func (f *fakeEsl) API(cmd string) (string, error) { return "+OK", nil }
+
+func (f *fakeEsl) ReadMessage() (fs.IEvent, error) {
+	select {
+	case e := <-f.events:
+		return e, nil
+	case <-f.closed:
+		return nil, io.EOF
+	}
+}
+
+func (f *fakeEsl) close() {
+	f.once.Do(func() { close(f.closed) })
+}
+
+type stressApp struct {
+	session fs.ISession
+	esl     *fakeEsl
+	uuid    string
+	wg      *sync.WaitGroup
+
+	unexpectedErrors *int32
+}
+
+func (app *stressApp) IsApplicable(event fs.IEvent) bool { return true }
+func (app *stressApp) Setup(event fs.IEvent)             { app.uuid = event.GetHeader("Unique-ID") }
+func (app *stressApp) Run() {
+	defer app.wg.Done()
+	app.session.AddEventHandler("CHANNEL_ANSWER", func(fs.IEvent) {})
+	_, err1 := app.session.Answer()
+	_, err2 := app.session.ExecBgAPI("status")
+	_, err3 := app.session.Playback("silence_stream://10")
+	for _, err := range []error{err1, err2, err3} {
+		if err != nil && !errors.Is(err, fs.ErrChannelClosed) {
+			atomic.AddInt32(app.unexpectedErrors, 1)
+		}
+	}
+	app.esl.push(fakeEvent{"Event-Name": "CHANNEL_DESTROY", "Unique-ID": app.uuid})
+}
+
+func TestMain(m *testing.M) {
+	SetLogLevel(l.ERROR)
+	os.Exit(m.Run())
+}
+
+func TestEslConnectionHandlerStress(t *testing.T) {
+	const channels = 3000
+
+	esl := newFakeEsl()
+	m := NewSessionManager(esl)
+	wg := &sync.WaitGroup{}
+	wg.Add(channels)
+	var unexpectedErrors int32
+	factory := func(s fs.ISession) IEslApp {
+		return &stressApp{session: s, esl: esl, wg: wg, unexpectedErrors: &unexpectedErrors}
+	}
+	served := make(chan error, 1)
+	go func() { served <- m.Serve(factory) }()
+
+	for w := 0; w < 4; w++ {
+		go func(w int) {
+			for i := w; i < channels; i += 4 {
+				uuid := fmt.Sprintf("channel-%d", i)
+				park := fakeEvent{"Event-Name": "CHANNEL_PARK", "Unique-ID": uuid}
+				if i%7 == 0 { //some channels hangup before app gets a chance to run
+					esl.push(park, park, fakeEvent{"Event-Name": "CHANNEL_DESTROY", "Unique-ID": uuid})
+				} else { //duplicate parks must not create a second session
+					esl.push(park, park)
+				}
+				if i%50 == 0 {
+					if _, err := m.BgAPI("status", 5); err != nil {
+						t.Errorf("BgAPI failed: %s", err)
+					}
+				}
+			}
+		}(w)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("apps did not finish, %d sessions left", m.sessions.count())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.sessions.count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := m.sessions.count(); n != 0 {
+		t.Errorf("expected all sessions to be removed, %d left", n)
+	}
+	if n := atomic.LoadInt32(&unexpectedErrors); n != 0 {
+		t.Errorf("%d session operations failed with errors other than fs.ErrChannelClosed", n)
+	}
+	esl.close()
+	if err := <-served; err != io.EOF {
+		t.Errorf("expected EOF from Serve, got %v", err)
+	}
+}
+
+//downEsl fails every reconnect attempt and records when they were made
+type downEsl struct {
+	*fakeEsl
+	attempts []time.Time
+}
+
+func (f *downEsl) Reconnect() error {
+	f.attempts = append(f.attempts, time.Now())
+	return errors.New("connection refused")
+}
+
+func TestReconnectZeroDelay(t *testing.T) {
+	esl := &downEsl{fakeEsl: newFakeEsl()}
+	m := NewSessionManager(esl)
+	m.EnableReconnect(ReconnectPolicy{MaxAttempts: 3})
+	if err := m.reconnect(io.EOF); err == nil {
+		t.Fatal("reconnect succeeded")
+	}
+	if len(esl.attempts) != 3 {
+		t.Fatalf("%d attempts made", len(esl.attempts))
+	}
+	if gap := esl.attempts[1].Sub(esl.attempts[0]); gap < DefaultReconnectPolicy.InitialDelay {
+		t.Errorf("attempts retried after %s", gap)
+	}
+}
+
+func TestCancelOriginate(t *testing.T) {
+	m := NewSessionManager(newFakeEsl())
+	m.originates.add("a-uuid", func(fs.ISession) IEslApp { return &stressApp{} })
+	m.cancelOriginate("a-uuid")
+	f, found := m.originates.take("a-uuid")
+	if !found {
+		t.Fatal("timed out originate was forgotten before its channel was destroyed")
+	}
+	if f(nil).IsApplicable(fakeEvent{}) {
+		t.Error("late park of a timed out originate would be handled")
+	}
+}
@@ -0,0 +1,294 @@
+package eslsession
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//AnyDigit in State.OnDTMF matches every digit not listed
+const AnyDigit = "any"
+
+//State is a named step of a Flow. Enter runs when state is entered, then next state is chosen by
+//OnResult or Next, or else by the first of OnDTMF, OnEvent and Timeout which happens.
+//A matching DTMF or event arriving while Enter runs stops its application (see ISession.WithContext)
+//and moves to the next state. Empty next state ends the flow.
+//A hangup not handled by OnEvent ends the flow with *fs.ChannelClosedError unless Enter result moves on,
+//then it is kept for next state. Other events queued before a state is entered are dropped
+type State struct {
+	Name  string
+	Enter func(s fs.ISession) (fs.IEvent, error)
+	//OnResult chooses next state from result of Enter, returning "" falls back to Next and waiting.
+	//Without OnResult an Enter error ends the flow with that error
+	OnResult func(e fs.IEvent, err error) string
+	Next     string
+	//OnDTMF maps digits to next states, AnyDigit matches other digits
+	OnDTMF map[string]string
+	//OnEvent maps event names to next states, events must be subscribed by SessionManager (DefaultEvents)
+	OnEvent map[string]string
+	//Timeout is counted after Enter returns
+	Timeout   time.Duration
+	OnTimeout string
+}
+
+//waits reports if state waits for dtmf, events or timeout after Enter
+func (st *State) waits() bool {
+	return len(st.OnDTMF) > 0 || len(st.OnEvent) > 0 || st.Timeout > 0
+}
+
+//match returns next state for event, "" if state does not handle it
+func (st *State) match(e fs.IEvent) string {
+	name := e.GetHeader("Event-Name")
+	if name == "DTMF" && len(st.OnDTMF) > 0 {
+		if next, found := st.OnDTMF[e.GetHeader("DTMF-Digit")]; found {
+			return next
+		}
+		return st.OnDTMF[AnyDigit]
+	}
+	return st.OnEvent[name]
+}
+
+//Flow is a call flow made of states, it is run by an app on its session
+type Flow struct {
+	Name    string
+	Initial string
+	States  map[string]*State
+	//OnTransition is called before entering each state, from is "" for initial state
+	OnTransition func(uuid string, from string, to string)
+}
+
+//NewFlow creates a flow starting from the first state
+func NewFlow(name string, states ...*State) *Flow {
+	f := &Flow{Name: name, States: make(map[string]*State)}
+	for _, st := range states {
+		f.States[st.Name] = st
+	}
+	if len(states) > 0 {
+		f.Initial = states[0].Name
+	}
+	return f
+}
+
+//FlowStatus is where a call is in its flow
+type FlowStatus struct {
+	Flow  string
+	State string
+	Since time.Time
+}
+
+//CurrentFlowState returns state of flow running on channel uuid of manager
+func (m *SessionManager) CurrentFlowState(uuid string) (FlowStatus, bool) {
+	m.flowStatusesMtx.RLock()
+	defer m.flowStatusesMtx.RUnlock()
+	st, found := m.flowStatuses[uuid]
+	return st, found
+}
+
+//FlowStates returns states of all flows running on sessions of manager by channel uuid
+func (m *SessionManager) FlowStates() map[string]FlowStatus {
+	m.flowStatusesMtx.RLock()
+	defer m.flowStatusesMtx.RUnlock()
+	result := make(map[string]FlowStatus, len(m.flowStatuses))
+	for k, v := range m.flowStatuses {
+		result[k] = v
+	}
+	return result
+}
+
+func (m *SessionManager) setFlowStatus(uuid string, st FlowStatus) {
+	m.flowStatusesMtx.Lock()
+	defer m.flowStatusesMtx.Unlock()
+	if m.flowStatuses == nil {
+		m.flowStatuses = make(map[string]FlowStatus)
+	}
+	m.flowStatuses[uuid] = st
+}
+
+func (m *SessionManager) removeFlowStatus(uuid string) {
+	m.flowStatusesMtx.Lock()
+	defer m.flowStatusesMtx.Unlock()
+	delete(m.flowStatuses, uuid)
+}
+
+//flowTracker is implemented by sessions whose flow states are reported by their manager, *Session does
+type flowTracker interface {
+	trackFlow(st *FlowStatus)
+}
+
+//trackFlow sets flow status of session on its manager, nil removes it
+func (s *Session) trackFlow(st *FlowStatus) {
+	if st == nil {
+		s.manager.removeFlowStatus(s.uuid)
+		return
+	}
+	s.manager.setFlowStatus(s.uuid, *st)
+}
+
+//Run runs flow on session until a state ends it, channel hangs up or session context is done.
+//It adds handlers of all events used by states and CHANNEL_HANGUP to session and removes them on return
+func (f *Flow) Run(s fs.ISession) error {
+	events := make(chan fs.IEvent, 16)
+	hangups := make(chan fs.IEvent, 1) //channel hangs up once so it is never dropped
+	for _, name := range f.eventNames() {
+		queue := events
+		if name == "CHANNEL_HANGUP" {
+			queue = hangups
+		}
+		h := s.AddEventHandler(name, func(e fs.IEvent) {
+			select {
+			case queue <- e:
+			default: //flow is busy, drop
+			}
+		}, fs.HandleSync)
+		defer h.Remove()
+	}
+	track := func(*FlowStatus) {}
+	if t, ok := s.(flowTracker); ok {
+		track = t.trackFlow
+	}
+
+	uuid := s.UUID()
+	defer track(nil)
+	from := ""
+	for name := f.Initial; name != ""; {
+		st, found := f.States[name]
+		if !found {
+			return fmt.Errorf("flow %s has no state %s", f.Name, name)
+		}
+		if f.OnTransition != nil {
+			f.OnTransition(uuid, from, name)
+		}
+		track(&FlowStatus{Flow: f.Name, State: name, Since: time.Now()})
+		drain(events)
+		next, err := st.run(s, events, hangups)
+		if err != nil {
+			return err
+		}
+		from, name = name, next
+	}
+	return nil
+}
+
+//eventNames returns events flow needs handlers for
+func (f *Flow) eventNames() []string {
+	names := map[string]bool{"CHANNEL_HANGUP": true}
+	for _, st := range f.States {
+		if len(st.OnDTMF) > 0 {
+			names["DTMF"] = true
+		}
+		for name := range st.OnEvent {
+			names[name] = true
+		}
+	}
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	return list
+}
+
+//drain drops events queued for previous states
+func drain(events chan fs.IEvent) {
+	for {
+		select {
+		case <-events:
+		default:
+			return
+		}
+	}
+}
+
+type enterResult struct {
+	event fs.IEvent
+	err   error
+}
+
+//run enters state and returns next state, a hangup received but not handled is put back for next state
+func (st *State) run(s fs.ISession, events chan fs.IEvent, hangups chan fs.IEvent) (next string, err error) {
+	ctx, cancel := context.WithCancel(s.Context())
+	defer cancel()
+	entered := make(chan enterResult, 1)
+	go func() {
+		if st.Enter == nil {
+			entered <- enterResult{}
+			return
+		}
+		e, err := st.Enter(s.WithContext(ctx))
+		entered <- enterResult{e, err}
+	}()
+
+	closed := s.Done()
+	var timeout <-chan time.Time
+	var hangup error
+	var hangupEvent fs.IEvent
+	defer func() {
+		if hangupEvent != nil && next != "" {
+			select {
+			case hangups <- hangupEvent:
+			default:
+			}
+		}
+	}()
+	for {
+		select {
+		case r := <-entered:
+			entered = nil
+			closed = s.Done() //watched again in case it was closed while Enter was running
+			if st.OnResult != nil {
+				if next := st.OnResult(r.event, r.err); next != "" {
+					return next, nil
+				}
+			} else if r.err != nil {
+				return "", r.err
+			}
+			if st.Next != "" || !st.waits() {
+				return st.Next, nil
+			}
+			if hangup != nil {
+				return "", hangup
+			}
+			if st.Timeout > 0 {
+				timer := time.NewTimer(st.Timeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+		case e := <-hangups:
+			if next := st.match(e); next != "" {
+				return st.leave(next, cancel, entered), nil
+			}
+			hangup = channelClosed(s.UUID(), e.GetHeader("Hangup-Cause"))
+			if entered == nil {
+				return "", hangup
+			}
+			hangupEvent = e //result of Enter decides, e.g. a state which hangs up itself
+		case e := <-events:
+			if next := st.match(e); next != "" {
+				return st.leave(next, cancel, entered), nil
+			}
+		case <-timeout:
+			return st.OnTimeout, nil
+		case <-closed:
+			if entered != nil {
+				closed = nil
+				continue
+			}
+			return "", s.Err()
+		case <-ctx.Done():
+			if entered != nil {
+				<-entered
+			}
+			return "", ctx.Err()
+		}
+	}
+}
+
+//leave stops application of Enter if it is still running and returns next
+func (st *State) leave(next string, cancel context.CancelFunc, entered chan enterResult) string {
+	if entered != nil {
+		cancel()
+		<-entered
+	}
+	return next
+}
@@ -0,0 +1,198 @@
+package eslsession_test
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+func init() {
+	goesl.SetLogLevel(l.ERROR)
+}
+
+type flowApp struct {
+	session fs.ISession
+	flow    *eslsession.Flow
+	result  chan error
+}
+
+func (app *flowApp) IsApplicable(fs.IEvent) bool { return true }
+func (app *flowApp) Setup(fs.IEvent)             {}
+func (app *flowApp) Run()                        { app.result <- app.flow.Run(app.session) }
+
+//runFlow runs flow on a parked fake channel, play is called once flow is running
+func runFlow(t *testing.T, s *esltest.Server, flow *eslsession.Flow, play func(m *eslsession.SessionManager, ch *esltest.Channel)) error {
+	t.Helper()
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	result := make(chan error, 1)
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+	go m.Serve(func(s fs.ISession) eslsession.IEslApp {
+		return &flowApp{session: s, flow: flow, result: result}
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	play(m, ch)
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("flow did not end")
+	}
+	return nil
+}
+
+//menuFlow plays a greeting which can be interrupted by 1, waits 100ms for it and says goodbye
+func menuFlow(transitions *[]string) *eslsession.Flow {
+	var mtx sync.Mutex
+	f := eslsession.NewFlow("menu",
+		&eslsession.State{
+			Name:      "greeting",
+			Enter:     func(s fs.ISession) (fs.IEvent, error) { return s.Playback("welcome.wav") },
+			OnDTMF:    map[string]string{"1": "sales", eslsession.AnyDigit: "greeting"},
+			Timeout:   100 * time.Millisecond,
+			OnTimeout: "goodbye",
+		},
+		&eslsession.State{
+			Name:  "sales",
+			Enter: func(s fs.ISession) (fs.IEvent, error) { return s.Set("department", "sales") },
+			Next:  "goodbye",
+		},
+		&eslsession.State{
+			Name:     "goodbye",
+			Enter:    func(s fs.ISession) (fs.IEvent, error) { return s.Hangup() },
+			OnResult: func(fs.IEvent, error) string { return "" }, //channel may be gone before hangup completes
+		},
+	)
+	f.OnTransition = func(uuid string, from string, to string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		*transitions = append(*transitions, from+">"+to)
+	}
+	return f
+}
+
+func newServer(t *testing.T) *esltest.Server {
+	s, err := esltest.NewServer("ClueCon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestFlowDTMFInterruptsState(t *testing.T) {
+	s := newServer(t)
+	s.HandleExecute("playback", func(ch *esltest.Channel, cmd esltest.Command) {}) //plays until broken
+	var transitions []string
+	var m *eslsession.SessionManager
+	err := runFlow(t, s, menuFlow(&transitions), func(sm *eslsession.SessionManager, ch *esltest.Channel) {
+		m = sm
+		if _, err := ch.WaitExecute("playback", 0); err != nil {
+			t.Fatal(err)
+		}
+		if st, _ := m.CurrentFlowState(ch.UUID); st.Flow != "menu" || st.State != "greeting" {
+			t.Errorf("unexpected flow state %+v", st)
+		}
+		ch.Event("DTMF", map[string]string{"DTMF-Digit": "1"})
+		if _, err := s.WaitCommand("bgapi uuid_break "+ch.UUID, 0); err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{">greeting", "greeting>sales", "sales>goodbye"}; !reflect.DeepEqual(transitions, want) {
+		t.Errorf("unexpected transitions %v", transitions)
+	}
+	if n := len(m.FlowStates()); n != 0 {
+		t.Errorf("%d flow states left after flow ended", n)
+	}
+}
+
+func TestFlowTimeout(t *testing.T) {
+	s := newServer(t)
+	var transitions []string
+	err := runFlow(t, s, menuFlow(&transitions), func(*eslsession.SessionManager, *esltest.Channel) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{">greeting", "greeting>goodbye"}; !reflect.DeepEqual(transitions, want) {
+		t.Errorf("unexpected transitions %v", transitions)
+	}
+}
+
+func TestFlowHangup(t *testing.T) {
+	s := newServer(t)
+	s.HandleExecute("playback", func(ch *esltest.Channel, cmd esltest.Command) {})
+	var transitions []string
+	err := runFlow(t, s, menuFlow(&transitions), func(m *eslsession.SessionManager, ch *esltest.Channel) {
+		if _, err := ch.WaitExecute("playback", 0); err != nil {
+			t.Fatal(err)
+		}
+		ch.Hangup("NORMAL_CLEARING")
+	})
+	var closed *fs.ChannelClosedError
+	if !errors.As(err, &closed) || closed.HangupCause != "NORMAL_CLEARING" {
+		t.Errorf("expected channel closed error, got %v", err)
+	}
+}
+
+func TestFlowEventsQueuedBetweenStates(t *testing.T) {
+	s := newServer(t)
+	var session fs.ISession
+	var transitions []string
+	entering := make(chan bool)
+	f := eslsession.NewFlow("queued",
+		&eslsession.State{
+			Name: "first",
+			Enter: func(s fs.ISession) (fs.IEvent, error) {
+				session = s
+				return nil, nil
+			},
+			Next: "second",
+		},
+		&eslsession.State{
+			Name:    "second",
+			OnDTMF:  map[string]string{"1": "stale"},
+			OnEvent: map[string]string{"CHANNEL_HANGUP": "hungup"},
+		},
+		&eslsession.State{Name: "stale"},
+		&eslsession.State{Name: "hungup"},
+	)
+	f.OnTransition = func(uuid string, from string, to string) {
+		transitions = append(transitions, from+">"+to)
+		if to == "second" {
+			close(entering)
+			<-session.Done() //all events below are queued while flow is busy
+		}
+	}
+	err := runFlow(t, s, f, func(m *eslsession.SessionManager, ch *esltest.Channel) {
+		<-entering
+		for i := 0; i < 20; i++ {
+			ch.Event("DTMF", map[string]string{"DTMF-Digit": "1"})
+		}
+		ch.Hangup("NORMAL_CLEARING")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{">first", "first>second", "second>hungup"}; !reflect.DeepEqual(transitions, want) {
+		t.Errorf("unexpected transitions %v", transitions)
+	}
+}
@@ -0,0 +1,160 @@
+package eslsession
+
+import (
+	"sync"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//GlobalEventQueueSize is how many events wait for global handlers before new ones are dropped
+var GlobalEventQueueSize = 256
+
+//EventMatcher selects events passed to a global handler
+type EventMatcher func(e fs.IEvent) bool
+
+//MatchName matches events named one of names, fs.CustomEventName(subclass) matches CUSTOM events of
+//subclass, CUSTOM matches all custom events and ALL matches every event
+func MatchName(names ...string) EventMatcher {
+	return func(e fs.IEvent) bool {
+		for _, name := range names {
+			if name == "ALL" {
+				return true
+			}
+			for _, n := range handlerNames(e) {
+				if n == name {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+//MatchSubclass matches CUSTOM events of one of subclasses
+func MatchSubclass(subclasses ...string) EventMatcher {
+	names := make([]string, len(subclasses))
+	for i, subclass := range subclasses {
+		names[i] = fs.CustomEventName(subclass)
+	}
+	return MatchName(names...)
+}
+
+//MatchHeader matches events whose header name has one of values
+func MatchHeader(name string, values ...string) EventMatcher {
+	return func(e fs.IEvent) bool {
+		v := e.GetHeader(name)
+		for _, value := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//MatchAll matches events accepted by all matchers
+func MatchAll(matchers ...EventMatcher) EventMatcher {
+	return func(e fs.IEvent) bool {
+		for _, m := range matchers {
+			if !m(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+type globalHandler struct {
+	match     EventMatcher
+	handler   fs.EventHandlerFunc
+	unmanaged bool
+}
+
+type globalEvent struct {
+	event   fs.IEvent
+	managed bool
+}
+
+//globalHandlers are connection wide handlers, events are queued by serve loop and handled in order on
+//one goroutine so a slow handler delays others but never the reader
+type globalHandlers struct {
+	mtx      sync.Mutex
+	handlers []globalHandler
+	queue    chan globalEvent
+}
+
+func newGlobalHandlers() *globalHandlers {
+	return &globalHandlers{queue: make(chan globalEvent, GlobalEventQueueSize)}
+}
+
+func (g *globalHandlers) add(h globalHandler) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.handlers = append(g.handlers, h)
+}
+
+func (g *globalHandlers) snapshot() []globalHandler {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return append([]globalHandler(nil), g.handlers...)
+}
+
+//publish queues event without blocking, returns false if it was dropped
+func (g *globalHandlers) publish(e fs.IEvent, managed bool) bool {
+	g.mtx.Lock()
+	empty := len(g.handlers) == 0
+	g.mtx.Unlock()
+	if empty {
+		return true
+	}
+	select {
+	case g.queue <- globalEvent{event: e, managed: managed}:
+		return true
+	default:
+		return false
+	}
+}
+
+//run calls handlers of queued events until stop is closed
+func (g *globalHandlers) run(stop chan struct{}) {
+	for {
+		select {
+		case ge := <-g.queue:
+			for _, h := range g.snapshot() {
+				if h.unmanaged && ge.managed {
+					continue
+				}
+				if h.match == nil || h.match(ge.event) {
+					h.handler(ge.event)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+//AddGlobalEventHandler calls handler for every event received by manager named eventName, whether or not
+//it belongs to a session. eventName is matched like MatchName. Events must be subscribed, see Subscribe.
+//Global handlers run in order of addition on one goroutine, events arriving while its queue is full are dropped
+func (m *SessionManager) AddGlobalEventHandler(eventName string, handler fs.EventHandlerFunc) {
+	m.globals.add(globalHandler{match: MatchName(eventName), handler: handler})
+}
+
+//AddGlobalEventFilter calls handler for every event received by manager which match accepts, nil match accepts all
+func (m *SessionManager) AddGlobalEventFilter(match EventMatcher, handler fs.EventHandlerFunc) {
+	m.globals.add(globalHandler{match: match, handler: handler})
+}
+
+//AddUnmanagedEventHandler calls handler for events which match accepts and belong to no session of manager:
+//events without Unique-ID like HEARTBEAT or PRESENCE_IN and events of channels not parked to manager
+func (m *SessionManager) AddUnmanagedEventHandler(match EventMatcher, handler fs.EventHandlerFunc) {
+	m.globals.add(globalHandler{match: match, handler: handler, unmanaged: true})
+}
+
+//publish passes an event to global handlers
+func (m *SessionManager) publish(e fs.IEvent, managed bool) {
+	if !m.globals.publish(e, managed) {
+		m.logger.Warning("global event queue is full, dropped %s", e.GetHeader("Event-Name"))
+	}
+}
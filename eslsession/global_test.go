@@ -0,0 +1,83 @@
+package eslsession_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+func TestGlobalEventHandlers(t *testing.T) {
+	s := newServer(t)
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	var mtx sync.Mutex
+	var handled []string
+	record := func(handler string) fs.EventHandlerFunc {
+		return func(e fs.IEvent) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			handled = append(handled, handler+" "+e.GetHeader("Event-Name")+" "+e.GetHeader("Unique-ID"))
+		}
+	}
+	m.AddGlobalEventHandler("HEARTBEAT", record("name"))
+	m.AddGlobalEventFilter(func(e fs.IEvent) bool { return e.GetHeader("Answer-State") == "answered" }, record("filter"))
+	m.AddUnmanagedEventHandler(eslsession.MatchName("CHANNEL_ANSWER"), record("unmanaged"))
+
+	started := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			started <- struct{}{}
+			<-done
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	managed := s.NewChannel(nil)
+	managed.Park()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not run")
+	}
+	unmanaged := s.NewChannel(nil)
+	managed.Answer()
+	unmanaged.Answer()
+	s.Event(map[string]string{"Event-Name": "HEARTBEAT"}, "")
+
+	want := []string{
+		"filter CHANNEL_ANSWER " + managed.UUID,
+		"filter CHANNEL_ANSWER " + unmanaged.UUID,
+		"unmanaged CHANNEL_ANSWER " + unmanaged.UUID,
+		"name HEARTBEAT ",
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mtx.Lock()
+		got := append([]string(nil), handled...)
+		mtx.Unlock()
+		if len(got) >= len(want) {
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected handled events\n%q\n%q", got, want)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handled only %q", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,132 @@
+package eslsession
+
+import (
+	"sync"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//eventHandler is one registration of a session event handler, it is its own removal handle
+type eventHandler struct {
+	name    string
+	handler fs.EventHandlerFunc
+	once    bool
+	sync    bool
+	owner   *handlerRegistry
+}
+
+//Remove stops handler from receiving events, safe to call more than once
+func (h *eventHandler) Remove() {
+	h.owner.remove(h)
+}
+
+//handlerRegistry keeps handlers of a session by event name in order of addition
+type handlerRegistry struct {
+	mtx      sync.Mutex
+	handlers map[string][]*eventHandler
+}
+
+func newHandlerRegistry() *handlerRegistry {
+	return &handlerRegistry{handlers: make(map[string][]*eventHandler)}
+}
+
+func (r *handlerRegistry) add(name string, handler fs.EventHandlerFunc, options []fs.HandlerOption) *eventHandler {
+	h := &eventHandler{name: name, handler: handler, owner: r}
+	for _, o := range options {
+		switch o {
+		case fs.HandleOnce:
+			h.once = true
+		case fs.HandleSync:
+			h.sync = true
+		}
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.handlers[name] = append(r.handlers[name], h)
+	return h
+}
+
+func (r *handlerRegistry) remove(h *eventHandler) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	list := r.handlers[h.name]
+	for i, x := range list {
+		if x == h {
+			r.handlers[h.name] = append(list[:i:i], list[i+1:]...)
+			if len(r.handlers[h.name]) == 0 {
+				delete(r.handlers, h.name)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+//take returns handlers of the first of names having any, one-shot handlers are removed so they run once
+func (r *handlerRegistry) take(names []string) []*eventHandler {
+	r.mtx.Lock()
+	list := []*eventHandler(nil)
+	for _, name := range names {
+		if list = append(list, r.handlers[name]...); len(list) > 0 {
+			break
+		}
+	}
+	r.mtx.Unlock()
+	result := list[:0:0]
+	for _, h := range list {
+		if !h.once || r.remove(h) { //a one-shot handler removed meanwhile is skipped
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+//handlerQueue runs async handlers of a session one by one in order of events
+type handlerQueue struct {
+	mtx   sync.Mutex
+	calls []func()
+	wake  chan struct{}
+}
+
+func newHandlerQueue() *handlerQueue {
+	return &handlerQueue{wake: make(chan struct{}, 1)}
+}
+
+//push queues call without blocking
+func (q *handlerQueue) push(call func()) {
+	q.mtx.Lock()
+	q.calls = append(q.calls, call)
+	q.mtx.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+//run runs queued calls until done is closed, calls queued before that are run first
+func (q *handlerQueue) run(done chan struct{}) {
+	for {
+		select {
+		case <-q.wake:
+		case <-done:
+			q.runQueued()
+			return
+		}
+		q.runQueued()
+	}
+}
+
+func (q *handlerQueue) runQueued() {
+	for {
+		q.mtx.Lock()
+		calls := q.calls
+		q.calls = nil
+		q.mtx.Unlock()
+		if len(calls) == 0 {
+			return
+		}
+		for _, call := range calls {
+			call()
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package eslsession_test
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+//calls records names of handlers called in order
+type calls struct {
+	mtx   sync.Mutex
+	names []string
+}
+
+func (c *calls) handler(name string) fs.EventHandlerFunc {
+	return func(fs.IEvent) {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		c.names = append(c.names, name)
+	}
+}
+
+//wait waits until n calls are recorded and returns them
+func (c *calls) wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mtx.Lock()
+		names := append([]string(nil), c.names...)
+		c.mtx.Unlock()
+		if len(names) >= n {
+			return names
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %v called", names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSessionEventHandlers(t *testing.T) {
+	s := newServer(t)
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	var asyncCalls, syncCalls calls
+	removable := make(chan fs.IEventHandle, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			sess.AddEventHandler("CHANNEL_ANSWER", asyncCalls.handler("first"))
+			h := sess.AddEventHandler("CHANNEL_ANSWER", asyncCalls.handler("second"))
+			sess.AddEventHandler("CHANNEL_ANSWER", asyncCalls.handler("once"), fs.HandleOnce)
+			sess.AddEventHandler("CHANNEL_ANSWER", syncCalls.handler("sync"), fs.HandleSync)
+			removable <- h
+			<-done
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	var h fs.IEventHandle
+	select {
+	case h = <-removable:
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not run")
+	}
+
+	ch.Answer()
+	if names := asyncCalls.wait(t, 3); !reflect.DeepEqual(names, []string{"first", "second", "once"}) {
+		t.Errorf("unexpected handlers %v", names)
+	}
+	h.Remove()
+	h.Remove()
+	ch.Answer()
+	if names := asyncCalls.wait(t, 4); !reflect.DeepEqual(names[3:], []string{"first"}) {
+		t.Errorf("unexpected handlers after removal %v", names)
+	}
+	if names := syncCalls.wait(t, 2); len(names) != 2 {
+		t.Errorf("sync handler called %d times", len(names))
+	}
+}
+
+func TestChannelDestroyHandlers(t *testing.T) {
+	s := newServer(t)
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	var destroyed calls
+	added := make(chan struct{})
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			sess.AddEventHandler("CHANNEL_DESTROY", destroyed.handler("async"))
+			sess.AddEventHandler("CHANNEL_DESTROY", destroyed.handler("sync"), fs.HandleSync)
+			close(added)
+			<-sess.Done()
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not run")
+	}
+	ch.Hangup("NORMAL_CLEARING")
+	names := destroyed.wait(t, 2)
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"async", "sync"}) {
+		t.Errorf("unexpected CHANNEL_DESTROY handlers %v", names)
+	}
+}
@@ -0,0 +1,101 @@
+package eslsession
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//digitsVarCount makes variable names of digit collections unique in process
+var digitsVarCount uint64
+
+//default digit collection settings
+const (
+	DefaultDigitsTimeout     = 5 * time.Second
+	DefaultDigitsTerminators = "#"
+	DefaultDigitsRegexp      = `\d+`
+)
+
+//quoteArg quotes an application argument containing spaces or quotes so freeswitch keeps it as one
+//argument, empty arguments are passed as ''
+func quoteArg(arg string) string {
+	if arg == "" || arg == "''" {
+		return "''"
+	}
+	if !strings.ContainsAny(arg, " \t'\"") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	return "'" + strings.ReplaceAll(arg, "'", `\'`) + "'"
+}
+
+func millis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+//GetDigits plays Prompt and collects digits with play_and_get_digits. Tries are run one by one so result
+//tells how many were played and how the last one ended, invalid input or timeout is not an error
+func (s *Session) GetDigits(o fs.GetDigitsOptions) (*fs.GetDigitsResult, error) {
+	if o.Min <= 0 {
+		o.Min = 1
+	}
+	if o.Max < o.Min {
+		o.Max = o.Min
+	}
+	if o.Tries <= 0 {
+		o.Tries = 1
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultDigitsTimeout
+	}
+	if o.DigitTimeout <= 0 {
+		o.DigitTimeout = o.Timeout
+	}
+	if o.Terminators == "" {
+		o.Terminators = DefaultDigitsTerminators
+	}
+	if o.Regexp == "" {
+		o.Regexp = DefaultDigitsRegexp
+	}
+
+	result := &fs.GetDigitsResult{}
+	for result.Attempts < o.Tries {
+		result.Attempts++
+		varName := fmt.Sprintf("get_digits_%d", atomic.AddUint64(&digitsVarCount, 1))
+		transfer := ""
+		if result.Attempts == o.Tries { //freeswitch transfers when its tries are exhausted
+			transfer = o.TransferOnFailure
+		}
+		args := []string{strconv.Itoa(o.Min), strconv.Itoa(o.Max), "1", strconv.FormatInt(millis(o.Timeout), 10),
+			quoteArg(o.Terminators), quoteArg(o.Prompt), quoteArg(o.InvalidPrompt), varName, quoteArg(o.Regexp),
+			strconv.FormatInt(millis(o.DigitTimeout), 10)}
+		if transfer != "" {
+			args = append(args, quoteArg(transfer))
+		}
+		//read_terminator_used is kept by channel, a try ended by timeout or max digits does not set it
+		if _, err := s.Unset("read_terminator_used"); err != nil {
+			return result, err
+		}
+		e, err := s.exec("play_and_get_digits", strings.Join(args, " "))
+		if err != nil {
+			return result, err
+		}
+		result.Event = e
+		result.Digits = e.GetHeader("variable_" + varName)
+		if result.Digits != "" {
+			result.Status = fs.DigitsCollected
+			result.Terminator = e.GetHeader("variable_read_terminator_used")
+			return result, nil
+		}
+		if result.Invalid = e.GetHeader("variable_" + varName + "_invalid"); result.Invalid != "" {
+			result.Status = fs.DigitsInvalid
+		} else {
+			result.Status = fs.DigitsTimeout
+		}
+	}
+	return result, nil
+}
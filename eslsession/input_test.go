@@ -0,0 +1,122 @@
+package eslsession_test
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+var digitsVar = regexp.MustCompile(`get_digits_\d+`)
+
+type digitsResult struct {
+	result *fs.GetDigitsResult
+	err    error
+}
+
+func TestGetDigits(t *testing.T) {
+	s := newServer(t)
+	var mtx sync.Mutex
+	var args []string
+	inputs := []string{"invalid:99", "", "1234#", "", "", "56"} //per try, "" is a timeout
+	//read_terminator_used is kept by channel until it is unset
+	terminator := ""
+	s.HandleExecute("unset", func(ch *esltest.Channel, cmd esltest.Command) {
+		mtx.Lock()
+		if cmd.AppArg() == "read_terminator_used" {
+			terminator = ""
+		}
+		mtx.Unlock()
+		ch.CompleteExecute(cmd, nil)
+	})
+	s.HandleExecute("play_and_get_digits", func(ch *esltest.Channel, cmd esltest.Command) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		args = append(args, cmd.AppArg())
+		varName := digitsVar.FindString(cmd.AppArg())
+		input := inputs[0]
+		inputs = inputs[1:]
+		headers := map[string]string{}
+		if strings.HasPrefix(input, "invalid:") {
+			headers["variable_"+varName+"_invalid"] = strings.TrimPrefix(input, "invalid:")
+		} else if input != "" {
+			if strings.HasSuffix(input, "#") {
+				terminator = "#"
+			}
+			headers["variable_"+varName] = strings.TrimSuffix(input, "#")
+		}
+		if terminator != "" {
+			headers["variable_read_terminator_used"] = terminator
+		}
+		ch.CompleteExecute(cmd, headers)
+	})
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	results := make(chan digitsResult, 3)
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			r, err := sess.GetDigits(fs.GetDigitsOptions{Min: 4, Max: 4, Tries: 3, Timeout: 3 * time.Second,
+				Prompt: "ivr/enter pin.wav", InvalidPrompt: "ivr/invalid.wav", Regexp: `^\d{4}$`,
+				TransferOnFailure: "operator XML default"})
+			results <- digitsResult{r, err}
+			r, err = sess.GetDigits(fs.GetDigitsOptions{Tries: 2, Prompt: "ivr/menu.wav"})
+			results <- digitsResult{r, err}
+			r, err = sess.GetDigits(fs.GetDigitsOptions{Max: 2, Prompt: "ivr/menu.wav"})
+			results <- digitsResult{r, err}
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	s.NewChannel(nil).Park()
+	next := func() digitsResult {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("digits not collected")
+		}
+		return digitsResult{}
+	}
+
+	r := next().result
+	if r.Status != fs.DigitsCollected || r.Digits != "1234" || r.Terminator != "#" || r.Attempts != 3 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	r = next().result
+	if r.Status != fs.DigitsTimeout || r.Digits != "" || r.Attempts != 2 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	r = next().result
+	if r.Status != fs.DigitsCollected || r.Digits != "56" || r.Terminator != "" {
+		t.Errorf("terminator of an earlier collection is reported %+v", r)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if !strings.HasPrefix(args[0], `4 4 1 3000 # 'ivr/enter pin.wav' ivr/invalid.wav get_digits_`) ||
+		!strings.HasSuffix(args[0], ` ^\d{4}$ 3000`) {
+		t.Errorf("unexpected arguments %s", args[0])
+	}
+	if strings.Contains(args[1], "operator") || !strings.HasSuffix(args[2], ` 3000 'operator XML default'`) {
+		t.Errorf("transfer on failure must be passed to last try only: %q", args)
+	}
+	if !strings.HasPrefix(args[3], `1 1 1 5000 # ivr/menu.wav '' get_digits_`) {
+		t.Errorf("unexpected default arguments %s", args[3])
+	}
+}
@@ -0,0 +1,125 @@
+package eslsession
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	"github.com/google/uuid"
+)
+
+//OriginateRequest describes an outbound call placed by SessionManager.Originate
+type OriginateRequest struct {
+	//DialString is the endpoint to call e.g. user/1000 or sofia/gateway/gw1/09121234567
+	DialString     string
+	CallerIDName   string
+	CallerIDNumber string
+	//Timeout is seconds to wait for answer, 0 uses freeswitch default of 60
+	Timeout int
+	//Variables are set on the channel before it is created, origination_uuid is set by Originate and
+	//cannot be overridden
+	Variables map[string]string
+}
+
+//defaultOriginateTimeout is freeswitch default originate_timeout
+const defaultOriginateTimeout = 60
+
+//originateString builds originate api arguments which park the channel with given uuid after answer
+func (r OriginateRequest) originateString(channelUUID string) string {
+	vars := map[string]string{}
+	for k, v := range r.Variables {
+		vars[k] = v
+	}
+	vars["origination_uuid"] = channelUUID //parked channel is matched to its factory by it
+	if r.CallerIDName != "" {
+		vars["origination_caller_id_name"] = r.CallerIDName
+	}
+	if r.CallerIDNumber != "" {
+		vars["origination_caller_id_number"] = r.CallerIDNumber
+	}
+	if r.Timeout > 0 {
+		vars["originate_timeout"] = strconv.Itoa(r.Timeout)
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + quoteVariable(vars[k])
+	}
+	return "{" + strings.Join(pairs, ",") + "}" + r.DialString + " &park()"
+}
+
+//quoteVariable escapes commas which separate variables and quotes values with spaces
+func quoteVariable(v string) string {
+	v = strings.ReplaceAll(v, ",", "\\,")
+	if strings.ContainsAny(v, " \t") {
+		v = "'" + v + "'"
+	}
+	return v
+}
+
+//originatedApp runs apps of originated channels without asking IsApplicable, the channel is theirs
+type originatedApp struct {
+	IEslApp
+}
+
+func (app originatedApp) IsApplicable(fs.IEvent) bool {
+	return true
+}
+
+//cancelledApp is run on channels whose originate timed out, it is never applicable so they are not handled
+type cancelledApp struct{}
+
+func (cancelledApp) IsApplicable(fs.IEvent) bool { return false }
+func (cancelledApp) Setup(fs.IEvent)             {}
+func (cancelledApp) Run()                        {}
+
+//cancelOriginate hangs up a channel whose originate timed out, it may still be answered later. Its factory
+//is replaced by cancelledApp until CHANNEL_DESTROY so a park racing the hangup does not reach the default app
+func (m *SessionManager) cancelOriginate(channelUUID string) {
+	m.originates.add(channelUUID, func(fs.ISession) IEslApp { return cancelledApp{} })
+	if _, err := m.API("uuid_kill " + channelUUID + " ORIGINATOR_CANCEL"); err != nil {
+		m.logger.Debug("channel %s of timed out originate is gone: %s", channelUUID, err)
+		m.originates.remove(channelUUID)
+	}
+}
+
+//Originate places an outbound call and blocks until it is answered or fails. Once answered the channel is
+//parked and an app created by factory controls it like a parked inbound call. Returns uuid of the channel
+//or *fs.OriginateError with the hangup cause e.g. NO_ANSWER or USER_BUSY.
+//Serve must be running on the manager since results and channel events are read by it
+func (m *SessionManager) Originate(r OriginateRequest, factory EslAppFactory) (string, error) {
+	channelUUID := uuid.New().String()
+	m.originates.add(channelUUID, func(s fs.ISession) IEslApp {
+		return originatedApp{factory(s)}
+	})
+
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultOriginateTimeout
+	}
+	//originate_timeout covers ringing only, leave some time for call setup
+	result, err := m.BgAPI("originate "+r.originateString(channelUUID), timeout+10)
+	if errors.Is(err, fs.ErrTimeout) {
+		m.cancelOriginate(channelUUID)
+		return "", err
+	}
+	if err != nil {
+		m.originates.remove(channelUUID)
+		return "", err
+	}
+	result = strings.TrimSpace(result)
+	if !strings.HasPrefix(result, "+OK") {
+		m.originates.remove(channelUUID)
+		cause := strings.TrimSpace(strings.TrimPrefix(result, "-ERR"))
+		m.logger.Info("originate %s failed: %s", r.DialString, cause)
+		return "", &fs.OriginateError{DialString: r.DialString, Cause: cause}
+	}
+	m.logger.Info("originated %s on channel %s", r.DialString, channelUUID)
+	return channelUUID, nil
+}
@@ -0,0 +1,52 @@
+package eslsession
+
+import (
+	"fmt"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//OutboundConnectionHandler controls the channel of a connection accepted from freeswitch socket application
+//(<action application="socket" data="127.0.0.1:8084 async full"/>). It connects, subscribes to channel
+//events with linger and runs the app created by factory on it the same way a parked channel is handled
+//by Serve, so one app can be used in both modes. Events are subscribed in DefaultEventFormat.
+//Returns when freeswitch closes the connection
+func OutboundConnectionHandler(c fs.IEsl, factory EslAppFactory) error {
+	m := NewSessionManager(c)
+	m.outbound = true
+
+	if err := c.Send("connect"); err != nil {
+		return err
+	}
+	//reply of connect carries channel data
+	channelData, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if channelData.GetHeader("Unique-ID") == "" {
+		return fmt.Errorf("connect reply has no channel data: %s", channelData.GetHeader("Reply-Text"))
+	}
+	if err := m.subscribeChannel(); err != nil {
+		return err
+	}
+
+	s := m.newSession(channelData)
+	m.sessions.add(s)
+	go m.eslSessionHandler(s, channelData, factory)
+	return m.serve(factory)
+}
+
+//subscribeChannel lingers so events after hangup are received until channel is destroyed and subscribes
+//events of outbound connection's channel. Nothing reads events yet, so myevents is the last command waiting for a reply
+func (m *SessionManager) subscribeChannel() error {
+	if sub, ok := m.client.(fs.IEventSubscriber); ok {
+		if err := sub.Linger(0); err != nil {
+			return err
+		}
+		return sub.MyEvents(m.eventFormat, "")
+	}
+	if err := m.client.Send("linger"); err != nil {
+		return err
+	}
+	return m.client.Send("myevents " + m.eventFormat)
+}
@@ -0,0 +1,120 @@
+package eslsession
+
+import (
+	"encoding/json"
+	"time"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//ReconnectPolicy controls how SessionManager reconnects after losing its esl connection
+type ReconnectPolicy struct {
+	//InitialDelay is wait time after first failed attempt, doubled after each failure up to MaxDelay.
+	//0 means DefaultReconnectPolicy.InitialDelay
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	//MaxAttempts 0 means try forever
+	MaxAttempts int
+}
+
+//DefaultReconnectPolicy retries forever with backoff from 100ms to 10s
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: 100 * time.Millisecond,
+	MaxDelay:     10 * time.Second,
+}
+
+//EnableReconnect makes Serve reconnect instead of returning when connection is lost. Client must implement
+//fs.IReconnectable. After reconnecting events are subscribed again and sessions whose channels are still
+//live keep running, others are closed.
+//
+//Events fired while disconnected are lost, so an exec waiting for a CHANNEL_EXECUTE_COMPLETE sent in
+//that window keeps waiting until the channel is destroyed or its context is done
+func (m *SessionManager) EnableReconnect(p ReconnectPolicy) {
+	m.reconnectPolicy = &p
+}
+
+//reconnect blocks client users until connection is back or attempts are exhausted
+func (m *SessionManager) reconnect(cause error) error {
+	r, ok := m.client.(fs.IReconnectable)
+	if !ok || m.reconnectPolicy == nil {
+		return cause
+	}
+	p := m.reconnectPolicy
+	m.logger.Warning("connection lost (%s), reconnecting", cause)
+
+	m.clientMtx.Lock()
+	delay := p.InitialDelay
+	if delay <= 0 { //retrying without a pause would spin while clientMtx blocks every api call
+		delay = DefaultReconnectPolicy.InitialDelay
+	}
+	for attempt := 1; ; attempt++ {
+		err := r.Reconnect()
+		if err == nil {
+			m.logger.Notice("reconnected after %d attempts", attempt)
+			break
+		}
+		m.logger.Error("reconnect attempt %d failed: %s", attempt, err)
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			m.clientMtx.Unlock()
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+	m.clientMtx.Unlock()
+
+	if _, ok := m.client.(fs.IEventSubscriber); !ok { //subscribers restore their subscriptions themselves
+		if err := m.subscribe(); err != nil {
+			return err
+		}
+	}
+	//api responses are read by Serve goroutine so channels are discovered in another one
+	go m.resume()
+	return nil
+}
+
+//resume closes sessions whose channels disappeared while connection was lost
+func (m *SessionManager) resume() {
+	body, err := m.API("show channels as json")
+	if err != nil {
+		m.logger.Error("could not discover live channels: %s", err)
+		return
+	}
+	live, err := parseChannelUUIDs(body)
+	if err != nil {
+		m.logger.Error("could not parse live channels: %s", err)
+		return
+	}
+	for _, s := range m.sessions.snapshot() {
+		if live[s.uuid] {
+			s.logger.Info("channel survived reconnect")
+			continue
+		}
+		s.logger.Info("channel is gone after reconnect")
+		m.sessions.remove(s.uuid)
+		select {
+		case s.errors <- channelClosed(s.uuid, ""):
+		case <-s.done:
+		}
+	}
+}
+
+//parseChannelUUIDs reads uuids from output of "show channels as json"
+func parseChannelUUIDs(body string) (map[string]bool, error) {
+	var result struct {
+		Rows []struct {
+			UUID string `json:"uuid"`
+		} `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		return nil, err
+	}
+	live := make(map[string]bool, len(result.Rows))
+	for _, r := range result.Rows {
+		live[r.UUID] = true
+	}
+	return live, nil
+}
@@ -0,0 +1,280 @@
+package eslsession
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//RecordEvents are subscribed when a recording is started
+var RecordEvents = []string{"RECORD_START", "RECORD_STOP"}
+
+//recording tracks one recording by RECORD_START and RECORD_STOP events of its path
+type recording struct {
+	path    string
+	session *Session
+	stop    func() error
+
+	mtx       sync.Mutex
+	startedAt time.Time
+	started   fs.IEvent
+	stopped   fs.IEvent
+	done      chan struct{}
+	handles   []fs.IEventHandle
+}
+
+//recordVars returns channel variables of requested options in order, others are left to dialplan and profile
+func recordVars(o fs.RecordOptions) []string {
+	var vars []string
+	if o.Append {
+		vars = append(vars, "RECORD_APPEND")
+	}
+	if o.Stereo {
+		vars = append(vars, "RECORD_STEREO")
+	}
+	return vars
+}
+
+//setRecordVars sets variables of requested options, returned func unsets them once recording started so
+//they do not carry over to later recordings of the channel
+func (s *Session) setRecordVars(o fs.RecordOptions) (func(), error) {
+	vars := recordVars(o)
+	if len(vars) == 0 {
+		return func() {}, nil
+	}
+	set := make(map[string]string, len(vars))
+	for _, v := range vars {
+		set[v] = "true"
+	}
+	if _, err := s.MultiSet(set); err != nil {
+		return nil, err
+	}
+	return func() {
+		for _, v := range vars {
+			if _, err := s.Unset(v); err != nil {
+				s.logger.Debug("could not unset %s: %s", v, err)
+			}
+		}
+	}, nil
+}
+
+//newRecording subscribes record events and starts tracking path, it must be called before recording starts
+func (s *Session) newRecording(path string) (*recording, error) {
+	if err := s.manager.Subscribe(RecordEvents...); err != nil {
+		return nil, err
+	}
+	r := &recording{path: path, session: s, done: make(chan struct{})}
+	r.handles = []fs.IEventHandle{
+		s.AddEventHandler("RECORD_START", r.onStart, fs.HandleSync),
+		s.AddEventHandler("RECORD_STOP", r.onStop, fs.HandleSync),
+	}
+	return r, nil
+}
+
+//matches reports if event is about this recording, freeswitch reports relative paths expanded
+func (r *recording) matches(e fs.IEvent) bool {
+	p := e.GetHeader("Record-File-Path")
+	return p == r.path || strings.HasSuffix(p, "/"+r.path)
+}
+
+func (r *recording) onStart(e fs.IEvent) {
+	if !r.matches(e) {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.started, r.startedAt = e, time.Now()
+}
+
+func (r *recording) onStop(e fs.IEvent) {
+	if !r.matches(e) {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.stopped != nil {
+		return
+	}
+	r.stopped = e
+	close(r.done)
+	for _, h := range r.handles {
+		h.Remove()
+	}
+}
+
+//cancel stops tracking a recording which could not be started
+func (r *recording) cancel() {
+	for _, h := range r.handles {
+		h.Remove()
+	}
+}
+
+func (r *recording) Path() string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, e := range []fs.IEvent{r.stopped, r.started} {
+		if e != nil {
+			return e.GetHeader("Record-File-Path")
+		}
+	}
+	return r.path
+}
+
+func (r *recording) Duration() time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.stopped != nil {
+		if ms, err := strconv.ParseInt(r.stopped.GetHeader("variable_record_ms"), 10, 64); err == nil {
+			return time.Duration(ms) * time.Millisecond
+		}
+		if sec, err := strconv.ParseInt(r.stopped.GetHeader("variable_record_seconds"), 10, 64); err == nil {
+			return time.Duration(sec) * time.Second
+		}
+		return 0
+	}
+	if r.started != nil {
+		return time.Since(r.startedAt)
+	}
+	return 0
+}
+
+func (r *recording) Cause() string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.stopped == nil {
+		return ""
+	}
+	return r.stopped.GetHeader("Record-Completion-Cause")
+}
+
+func (r *recording) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *recording) Wait(timeout time.Duration) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ctx := r.session.Context()
+	select {
+	case <-r.done:
+		return nil
+	case <-expired:
+		return &fs.TimeoutError{Op: "recording " + r.path, Timeout: timeout}
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.session.done:
+		select {
+		case <-r.done:
+			return nil
+		default:
+		}
+		return r.session.err()
+	}
+}
+
+func (r *recording) Stop() error {
+	select {
+	case <-r.done:
+		return nil
+	default:
+	}
+	if r.stop == nil { //record application is stopped by breaking it
+		_, err := r.session.ExecAPI("uuid_break " + r.session.uuid)
+		return err
+	}
+	return r.stop()
+}
+
+//Record runs record application and blocks until recording ends by silence, limit, a terminator digit,
+//hangup or session context. Returned recording is already stopped
+func (s *Session) Record(path string, o fs.RecordOptions) (fs.IRecording, error) {
+	unset, err := s.setRecordVars(o)
+	if err != nil {
+		return nil, err
+	}
+	defer unset()
+	r, err := s.newRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{quoteArg(path)}
+	if o.Limit > 0 || o.SilenceThreshold > 0 {
+		args = append(args, strconv.Itoa(int(o.Limit/time.Second)))
+	}
+	if o.SilenceThreshold > 0 {
+		args = append(args, strconv.Itoa(o.SilenceThreshold), strconv.Itoa(o.SilenceHits))
+	}
+	if _, err := s.exec("record", strings.Join(args, " ")); err != nil {
+		r.cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+//RecordSession starts recording channel in background with record_session, returned recording is stopped
+//by Stop (stop_record_session) or hangup
+func (s *Session) RecordSession(path string, o fs.RecordOptions) (fs.IRecording, error) {
+	unset, err := s.setRecordVars(o)
+	if err != nil {
+		return nil, err
+	}
+	defer unset()
+	r, err := s.newRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	r.stop = func() error {
+		_, err := s.exec("stop_record_session", quoteArg(path))
+		return err
+	}
+	arg := quoteArg(path)
+	if o.Limit > 0 {
+		arg += " +" + strconv.Itoa(int(o.Limit/time.Second))
+	}
+	if _, err := s.exec("record_session", arg); err != nil {
+		r.cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+//UUIDRecord starts recording channel in background with uuid_record api, it does not use the channel's
+//application queue so it can be started while another application like bridge runs
+func (s *Session) UUIDRecord(path string, o fs.RecordOptions) (fs.IRecording, error) {
+	vars := recordVars(o)
+	if len(vars) > 0 {
+		if _, err := s.ExecAPI(fmt.Sprintf("uuid_setvar_multi %s %s=true", s.uuid, strings.Join(vars, "=true;"))); err != nil {
+			return nil, err
+		}
+		defer func() { //uuid_setvar without value unsets
+			for _, v := range vars {
+				s.ExecAPI(fmt.Sprintf("uuid_setvar %s %s", s.uuid, v))
+			}
+		}()
+	}
+	r, err := s.newRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	r.stop = func() error {
+		_, err := s.ExecAPI(fmt.Sprintf("uuid_record %s stop %s", s.uuid, quoteArg(path)))
+		return err
+	}
+	cmd := fmt.Sprintf("uuid_record %s start %s", s.uuid, quoteArg(path))
+	if o.Limit > 0 {
+		cmd += " " + strconv.Itoa(int(o.Limit/time.Second))
+	}
+	if _, err := s.ExecAPI(cmd); err != nil {
+		r.cancel()
+		return nil, err
+	}
+	return r, nil
+}
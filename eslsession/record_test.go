@@ -0,0 +1,128 @@
+package eslsession_test
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+const recordingsDir = "/var/lib/freeswitch/recordings/"
+
+func recordEvent(ch *esltest.Channel, name string, path string, ms string) {
+	headers := map[string]string{"Record-File-Path": recordingsDir + path}
+	if ms != "" {
+		headers["variable_record_ms"] = ms
+		headers["Record-Completion-Cause"] = "success-silence"
+	}
+	ch.Event(name, headers)
+}
+
+func TestRecording(t *testing.T) {
+	s := newServer(t)
+	s.HandleExecute("record", func(ch *esltest.Channel, cmd esltest.Command) {
+		path := strings.Fields(cmd.AppArg())[0]
+		recordEvent(ch, "RECORD_START", path, "")
+		recordEvent(ch, "RECORD_STOP", path, "3200")
+		ch.CompleteExecute(cmd, nil)
+	})
+	s.HandleExecute("record_session", func(ch *esltest.Channel, cmd esltest.Command) {
+		recordEvent(ch, "RECORD_START", strings.Fields(cmd.AppArg())[0], "")
+		ch.CompleteExecute(cmd, nil)
+	})
+	s.HandleExecute("stop_record_session", func(ch *esltest.Channel, cmd esltest.Command) {
+		recordEvent(ch, "RECORD_STOP", cmd.AppArg(), "1500")
+		ch.CompleteExecute(cmd, nil)
+	})
+	var mtx sync.Mutex
+	var apis []string
+	s.HandleAPI(func(cmd string) string {
+		mtx.Lock()
+		apis = append(apis, cmd)
+		mtx.Unlock()
+		return "+OK"
+	})
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	errs := make(chan error, 1)
+	var msg, call, uuidRec fs.IRecording
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			errs <- func() (err error) {
+				if msg, err = sess.Record("msg.wav", fs.RecordOptions{Limit: 30 * time.Second, SilenceThreshold: 200, SilenceHits: 3}); err != nil {
+					return err
+				}
+				if call, err = sess.RecordSession("call.wav", fs.RecordOptions{Stereo: true}); err != nil {
+					return err
+				}
+				if err = call.Stop(); err != nil {
+					return err
+				}
+				if err = call.Wait(5 * time.Second); err != nil {
+					return err
+				}
+				uuidRec, err = sess.UUIDRecord("bridge call.wav", fs.RecordOptions{Limit: time.Minute})
+				return err
+			}()
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("recordings did not complete")
+	}
+
+	if msg.Path() != recordingsDir+"msg.wav" || msg.Duration() != 3200*time.Millisecond || msg.Cause() != "success-silence" {
+		t.Errorf("unexpected recording %s %s %s", msg.Path(), msg.Duration(), msg.Cause())
+	}
+	if cmd, err := ch.WaitExecute("record", 0); err != nil || cmd.AppArg() != "msg.wav 30 200 3" {
+		t.Errorf("unexpected record arguments %q %v", cmd.AppArg(), err)
+	}
+	if call.Duration() != 1500*time.Millisecond {
+		t.Errorf("unexpected duration %s", call.Duration())
+	}
+	if cmd, err := ch.WaitExecute("multiset", 0); err != nil || cmd.AppArg() != "^^:RECORD_STEREO=true:" {
+		t.Errorf("record options not set %q %v", cmd.AppArg(), err)
+	}
+	//options are set only when requested and unset once recording started
+	want := []string{"record", "multiset", "record_session", "unset", "stop_record_session"}
+	if apps := ch.Apps(); !reflect.DeepEqual(apps, want) {
+		t.Errorf("unexpected apps %v", apps)
+	}
+	if cmd := ch.Executes()[3]; cmd.AppArg() != "RECORD_STEREO" {
+		t.Errorf("unexpected unset %q", cmd.AppArg())
+	}
+	if _, err := s.WaitCommand("event json RECORD_START RECORD_STOP", 0); err != nil {
+		t.Error(err)
+	}
+	select {
+	case <-uuidRec.Done():
+		t.Error("uuid_record stopped before RECORD_STOP")
+	default:
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(apis) != 1 || apis[0] != "uuid_record "+ch.UUID+" start 'bridge call.wav' 60" {
+		t.Errorf("unexpected apis %v", apis)
+	}
+}
@@ -0,0 +1,165 @@
+package eslsession
+
+import (
+	"sync"
+)
+
+/*
+Ownership model of SessionManager registries:
+
+ * sessions are added only by the Serve loop when it sees the first CHANNEL_PARK of a channel, before the
+   session goroutine starts, so a second park of the same channel can never create a second session.
+   They are removed by the Serve loop on CHANNEL_DESTROY or after a reconnect when their channel is no
+   longer live. A session whose app is not applicable is closed by its goroutine but stays registered
+   so later parks of the channel are ignored.
+   Everyone else only looks sessions up.
+ * originates are added by SessionManager.Originate before the originate is sent and removed by the Serve
+   loop when the channel parks (its app is started) or is destroyed, or by Originate when it fails.
+   A timed out originate replaces its factory by one of a never applicable app and keeps it until
+   CHANNEL_DESTROY, unless the channel is already gone.
+ * jobs are added by the goroutine issuing the bgapi (session loop or SessionManager.BgAPI caller) before
+   the command is written, and removed by whoever finishes first: the Serve loop on BACKGROUND_JOB or
+   the issuer on timeout.
+
+Values stored in registries are never mutated through the registry, only the tables themselves are guarded.
+*/
+
+//sessionRegistry is a concurrency safe table of sessions by channel uuid
+type sessionRegistry struct {
+	mtx      sync.RWMutex
+	sessions map[string]*Session
+}
+
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{sessions: make(map[string]*Session)}
+}
+
+//add registers session unless its channel already has one
+func (r *sessionRegistry) add(s *Session) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, found := r.sessions[s.uuid]; found {
+		return false
+	}
+	r.sessions[s.uuid] = s
+	return true
+}
+
+func (r *sessionRegistry) get(uuid string) (*Session, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	s, found := r.sessions[uuid]
+	return s, found
+}
+
+func (r *sessionRegistry) remove(uuid string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.sessions, uuid)
+}
+
+func (r *sessionRegistry) count() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return len(r.sessions)
+}
+
+//snapshot returns current sessions, safe to use after registry changes
+func (r *sessionRegistry) snapshot() []*Session {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	list := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		list = append(list, s)
+	}
+	return list
+}
+
+//jobRegistry relates background job uuids to sessions which issued them and to SessionManager.BgAPI callers
+type jobRegistry struct {
+	mtx      sync.Mutex
+	sessions map[string]string
+	waiters  map[string]bgAPICtx
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		sessions: make(map[string]string),
+		waiters:  make(map[string]bgAPICtx),
+	}
+}
+
+func (r *jobRegistry) addSessionJob(jobUUID string, sessionUUID string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.sessions[jobUUID] = sessionUUID
+}
+
+func (r *jobRegistry) addWaiter(ctx bgAPICtx) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.waiters[ctx.jobUUID] = ctx
+}
+
+func (r *jobRegistry) removeWaiter(jobUUID string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.waiters, jobUUID)
+}
+
+//finish removes job and returns its owners since a job result is delivered once
+func (r *jobRegistry) finish(jobUUID string) (sessionUUID string, waiter *bgAPICtx) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if s, found := r.sessions[jobUUID]; found {
+		sessionUUID = s
+		delete(r.sessions, jobUUID)
+	}
+	if w, found := r.waiters[jobUUID]; found {
+		waiter = &w
+		delete(r.waiters, jobUUID)
+	}
+	return
+}
+
+//waitersSnapshot returns pending BgAPI callers
+func (r *jobRegistry) waitersSnapshot() []bgAPICtx {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	list := make([]bgAPICtx, 0, len(r.waiters))
+	for _, w := range r.waiters {
+		list = append(list, w)
+	}
+	return list
+}
+
+//originateRegistry holds factories of apps waiting for their originated channels to park
+type originateRegistry struct {
+	mtx       sync.Mutex
+	factories map[string]EslAppFactory
+}
+
+func newOriginateRegistry() *originateRegistry {
+	return &originateRegistry{factories: make(map[string]EslAppFactory)}
+}
+
+func (r *originateRegistry) add(uuid string, f EslAppFactory) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.factories[uuid] = f
+}
+
+//take removes and returns factory of channel if it was originated by manager
+func (r *originateRegistry) take(uuid string) (EslAppFactory, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	f, found := r.factories[uuid]
+	delete(r.factories, uuid)
+	return f, found
+}
+
+func (r *originateRegistry) remove(uuid string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.factories, uuid)
+}
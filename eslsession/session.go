@@ -1,17 +1,55 @@
 package eslsession
 
 import (
+	"context"
 	"fmt"
 	"strconv"
-	"strings"
-	"time"
 
 	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
 )
 
 //Session main object to interact with a call
 type Session struct {
-	FsConnector
+	*FsConnector
+	ctx     context.Context
+	manager *SessionManager
+}
+
+//WithContext returns a view of session whose blocking operations are bound to ctx.
+//When ctx is done running application is stopped and operation returns ctx.Err()
+func (s *Session) WithContext(ctx context.Context) fs.ISession {
+	if ctx == nil {
+		panic("nil context")
+	}
+	s2 := *s
+	s2.ctx = ctx
+	return &s2
+}
+
+//Context returns context of session, background if none is set
+func (s *Session) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+//UUID returns uuid of managed channel
+func (s *Session) UUID() string {
+	return s.uuid
+}
+
+func (s *Session) exec(app string, args string) (fs.IEvent, error) {
+	return s.execContext(s.Context(), app, args)
+}
+
+func (s *Session) bgapi(cmd string) (fs.IEvent, error) {
+	return s.bgapiContext(s.Context(), cmd)
+}
+
+//ExecContext runs any dialplan application bound to ctx instead of session context
+func (s *Session) ExecContext(ctx context.Context, app string, args string) (fs.IEvent, error) {
+	return s.execContext(ctx, app, args)
 }
 
 //Set sets a variable on managed channel
@@ -19,9 +57,9 @@ func (s *Session) Set(name string, value string) (fs.IEvent, error) {
 	return s.exec("set", name+"="+value)
 }
 
-//Unset sets a variable on managed channel
+//Unset unsets a variable on managed channel
 func (s *Session) Unset(name string) (fs.IEvent, error) {
-	return s.exec("unseset", name)
+	return s.exec("unset", name)
 }
 
 //MultiSet sets multiple variable on managed channel
@@ -42,6 +80,11 @@ func (s *Session) MultiUnset(vars map[string]string) (fs.IEvent, error) {
 	return s.exec("multiunset", c)
 }
 
+//Exec runs any dialplan application with its raw argument string on managed channel
+func (s *Session) Exec(app string, args string) (fs.IEvent, error) {
+	return s.exec(app, args)
+}
+
 //Answer runs answer application on managed channel
 func (s *Session) Answer() (fs.IEvent, error) {
 	return s.exec("answer", "")
@@ -66,23 +109,26 @@ func (s *Session) Playback(path string) (fs.IEvent, error) {
 	return s.exec("playback", path)
 }
 
-//PlayAndGetDigits runs play_and_get_digits application on managed channel
+//PlayAndGetDigits runs play_and_get_digits application on managed channel, files, terminators and regexp
+//are quoted when needed. See GetDigits for a typed result
 func (s *Session) PlayAndGetDigits(min uint, max uint, tries uint, timeout uint,
 	terminators string, file string, invalidFile string, varName string, regexp string, digitTimeout uint,
 	transferOnFailure string) (fs.IEvent, error) {
-	args := fmt.Sprintf("%d %d %d %d %s %s %s %s %s %d %s",
-		min, max, tries, timeout, terminators, file, invalidFile, varName, regexp, digitTimeout, transferOnFailure)
-	return s.exec("play_and_get_digits", strings.TrimSpace(args))
+	args := fmt.Sprintf("%d %d %d %d %s %s %s %s %s %d", min, max, tries, timeout, quoteArg(terminators),
+		quoteArg(file), quoteArg(invalidFile), varName, quoteArg(regexp), digitTimeout)
+	if transferOnFailure != "" && transferOnFailure != "''" {
+		args += " " + quoteArg(transferOnFailure)
+	}
+	return s.exec("play_and_get_digits", args)
 }
 
-//PlayAndGetOneDigit a wrapper around freeswitch play_and_get_digits to get just one digit
+//PlayAndGetOneDigit a wrapper around freeswitch play_and_get_digits to get just one digit in 3 tries
 func (s *Session) PlayAndGetOneDigit(path string) (uint64, error) {
-	varname := "pagd-" + strconv.FormatInt(time.Now().Unix(), 10)
-	r, e := s.PlayAndGetDigits(1, 1, 3, 5000, "#", path, "''", varname, "\\d", 5000, "''")
+	r, e := s.GetDigits(fs.GetDigitsOptions{Max: 1, Tries: 3, Prompt: path, Regexp: `\d`})
 	if e != nil {
 		return 0, e
 	}
-	return strconv.ParseUint(r.GetHeader("variable_"+varname), 10, 32)
+	return strconv.ParseUint(r.Digits, 10, 32)
 }
 
 //Bridge runs bridge application on managed channel
@@ -110,9 +156,26 @@ func (s *Session) SendEvent(headers map[string]string) (fs.IEvent, error) {
 	//<action application="event" data="Event-Subclass=VoiceWorks.pl::ACDnotify,Event-Name=CUSTOM,state=Intro,condition=IntroPlayed"/>
 }
 
-//ExecAPI exectue freeswitch apis in blocking mode
-func (s *Session) ExecAPI(cmd string) error {
-	return nil
+//ExecAPI exectue freeswitch apis in blocking mode and returns response body
+func (s *Session) ExecAPI(cmd string) (string, error) {
+	if err := s.err(); err != nil {
+		return "", err
+	}
+	type apiResult struct {
+		body string
+		err  error
+	}
+	result := make(chan apiResult, 1)
+	go func() {
+		body, err := s.manager.API(cmd)
+		result <- apiResult{body, err}
+	}()
+	select {
+	case r := <-result:
+		return r.body, r.err
+	case <-s.Context().Done():
+		return "", s.Context().Err()
+	}
 }
 
 //ExecBgAPI exectue freeswitch apis in non blocking mode
@@ -120,7 +183,10 @@ func (s *Session) ExecBgAPI(cmd string) (fs.IEvent, error) {
 	return s.bgapi(cmd)
 }
 
-//AddEventHandler used to set handlers for different events by event name
-func (s *Session) AddEventHandler(eventName string, handler fs.EventHandlerFunc) {
-	s.EventHandlers[eventName] = handler
+//AddEventHandler adds a handler of events named eventName, CUSTOM events are handled by
+//fs.CustomEventName(subclass) handlers or else by CUSTOM handlers. Handlers of an event run in order of
+//addition, by default on a goroutine of session so they may block; see fs.HandleSync and fs.HandleOnce.
+//Returned handle removes handler
+func (s *Session) AddEventHandler(eventName string, handler fs.EventHandlerFunc, options ...fs.HandlerOption) fs.IEventHandle {
+	return s.handlers.add(eventName, handler, options)
 }
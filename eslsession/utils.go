@@ -16,3 +16,23 @@ func dumpAllRoutines() string {
 	runtime.Stack(buf, true)
 	return fmt.Sprintf("%s", buf)
 }
+
+//missing returns distinct values not in list
+func missing(list []string, values []string) []string {
+	var result []string
+	for _, v := range values {
+		if !containsString(list, v) && !containsString(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package eslsession
+
+import (
+	"time"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//eventWaiter receives the first event of a session accepted by match
+type eventWaiter struct {
+	match   func(fs.IEvent) bool
+	event   chan fs.IEvent
+	session *Session
+}
+
+//expect registers a waiter, events dispatched from now on are checked against match
+func (c *FsConnector) expect(w *eventWaiter) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.waiters = append(c.waiters, w)
+}
+
+//removeWaiter unregisters w, safe to call more than once
+func (c *FsConnector) removeWaiter(w *eventWaiter) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for i, x := range c.waiters {
+		if x == w {
+			c.waiters = append(c.waiters[:i:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//notifyWaiters passes event to waiters accepting it, each waiter gets one event
+func (c *FsConnector) notifyWaiters(event fs.IEvent) {
+	c.mtx.Lock()
+	waiters := c.waiters
+	c.mtx.Unlock()
+	for _, w := range waiters {
+		if w.match != nil && !w.match(event) {
+			continue
+		}
+		if c.removeWaiter(w) { //not cancelled meanwhile
+			w.event <- event
+		}
+	}
+}
+
+//Wait blocks until an accepted event arrives, timeout passes (0 waits without timeout), session context
+//is done or channel is destroyed. Timeout is returned as *fs.TimeoutError
+func (w *eventWaiter) Wait(timeout time.Duration) (fs.IEvent, error) {
+	defer w.Cancel()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ctx := w.session.Context()
+	select {
+	case e := <-w.event:
+		return e, nil
+	case <-expired:
+		return nil, &fs.TimeoutError{Op: "wait for event", Timeout: timeout}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-w.session.done:
+		select { //event which destroyed channel may be awaited
+		case e := <-w.event:
+			return e, nil
+		default:
+		}
+		return nil, w.session.err()
+	}
+}
+
+//Cancel stops waiting for events
+func (w *eventWaiter) Cancel() {
+	w.session.removeWaiter(w)
+}
+
+//ExpectEvent starts watching events of channel and returns a waiter receiving the first one match accepts,
+//nil match accepts all. Use it to wait for an event caused by an operation started after it, e.g.
+//
+//	w := s.ExpectEvent(eslsession.MatchName("CHANNEL_BRIDGE"))
+//	s.ExecBgAPI("uuid_bridge ...")
+//	e, err := w.Wait(10 * time.Second)
+func (s *Session) ExpectEvent(match func(fs.IEvent) bool) fs.IEventWaiter {
+	w := &eventWaiter{match: match, event: make(chan fs.IEvent, 1), session: s}
+	s.expect(w)
+	return w
+}
+
+//WaitForEvent blocks until an event of channel named one of names arrives, names are matched like MatchName.
+//Only events arriving after the call are seen, see ExpectEvent
+func (s *Session) WaitForEvent(timeout time.Duration, names ...string) (fs.IEvent, error) {
+	return s.ExpectEvent(MatchName(names...)).Wait(timeout)
+}
+
+//WaitForEventFunc blocks until an event of channel accepted by match arrives
+func (s *Session) WaitForEventFunc(timeout time.Duration, match func(fs.IEvent) bool) (fs.IEvent, error) {
+	return s.ExpectEvent(match).Wait(timeout)
+}
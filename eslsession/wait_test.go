@@ -0,0 +1,74 @@
+package eslsession_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+type waitResult struct {
+	event fs.IEvent
+	err   error
+}
+
+func TestWaitForEvent(t *testing.T) {
+	s := newServer(t)
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+
+	expecting := make(chan struct{})
+	results := make(chan waitResult, 3)
+	go m.Serve(func(sess fs.ISession) eslsession.IEslApp {
+		return runApp(func() {
+			w := sess.ExpectEvent(eslsession.MatchAll(eslsession.MatchName("DTMF"), eslsession.MatchHeader("DTMF-Digit", "5")))
+			close(expecting)
+			e, err := w.Wait(5 * time.Second)
+			results <- waitResult{e, err}
+			e, err = sess.WaitForEvent(50*time.Millisecond, "CHANNEL_UNBRIDGE")
+			results <- waitResult{e, err}
+			e, err = sess.WaitForEvent(0, "CHANNEL_BRIDGE")
+			results <- waitResult{e, err}
+		})
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	select {
+	case <-expecting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not run")
+	}
+	ch.Event("DTMF", map[string]string{"DTMF-Digit": "1"})
+	ch.Event("DTMF", map[string]string{"DTMF-Digit": "5"})
+
+	next := func() waitResult {
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait did not return")
+		}
+		return waitResult{}
+	}
+	if r := next(); r.err != nil || r.event.GetHeader("DTMF-Digit") != "5" {
+		t.Errorf("expected digit 5, got %v", r.err)
+	}
+	if r := next(); !errors.Is(r.err, fs.ErrTimeout) {
+		t.Errorf("expected timeout, got %v", r.err)
+	}
+	ch.Hangup("NORMAL_CLEARING")
+	if r := next(); !errors.Is(r.err, fs.ErrChannelClosed) {
+		t.Errorf("expected channel closed, got %v", r.err)
+	}
+}
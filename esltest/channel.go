@@ -0,0 +1,162 @@
+package esltest
+
+import (
+	"fmt"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Command is a command received from a client
+type Command struct {
+	//Line is first line of command e.g. "sendmsg <uuid>" or "api status"
+	Line    string
+	Headers textproto.MIMEHeader
+	Body    string
+}
+
+//UUID returns channel uuid of a sendmsg
+func (c Command) UUID() string {
+	return strings.TrimPrefix(c.Line, "sendmsg ")
+}
+
+//App returns application name of a sendmsg execute
+func (c Command) App() string {
+	return c.Headers.Get("Execute-App-Name")
+}
+
+//AppArg returns application argument of a sendmsg execute
+func (c Command) AppArg() string {
+	return c.Headers.Get("Execute-App-Arg")
+}
+
+//appHeaders are headers of CHANNEL_EXECUTE and CHANNEL_EXECUTE_COMPLETE of an execute
+func (c Command) appHeaders() map[string]string {
+	return map[string]string{
+		"Application":      c.App(),
+		"Application-Data": c.AppArg(),
+		"Application-UUID": c.Headers.Get("Event-UUID"),
+	}
+}
+
+//Channel is a fake channel of Server
+type Channel struct {
+	UUID   string
+	server *Server
+
+	mtx  sync.Mutex
+	vars map[string]string
+}
+
+//Set sets a channel variable sent with later events
+func (ch *Channel) Set(name string, value string) {
+	ch.mtx.Lock()
+	defer ch.mtx.Unlock()
+	ch.vars[name] = value
+}
+
+//Event sends an event of channel with its Unique-ID and variables added to headers
+func (ch *Channel) Event(name string, headers map[string]string) {
+	h := map[string]string{
+		"Event-Name":        name,
+		"Unique-ID":         ch.UUID,
+		"Channel-Call-UUID": ch.UUID,
+	}
+	ch.mtx.Lock()
+	for k, v := range ch.vars {
+		h["variable_"+k] = v
+	}
+	ch.mtx.Unlock()
+	for k, v := range headers {
+		h[k] = v
+	}
+	ch.server.Event(h, "")
+}
+
+//Park sends CHANNEL_PARK, which makes eslsession run an app on the channel
+func (ch *Channel) Park() {
+	ch.Event("CHANNEL_PARK", nil)
+}
+
+//Answer sends CHANNEL_ANSWER
+func (ch *Channel) Answer() {
+	ch.Event("CHANNEL_ANSWER", map[string]string{"Answer-State": "answered"})
+}
+
+//Hangup sends CHANNEL_HANGUP and CHANNEL_DESTROY with cause, after that channel is not live
+func (ch *Channel) Hangup(cause string) {
+	headers := map[string]string{"Hangup-Cause": cause, "Answer-State": "hangup"}
+	ch.Event("CHANNEL_HANGUP", headers)
+	ch.server.mtx.Lock()
+	delete(ch.server.channels, ch.UUID)
+	ch.server.notify()
+	ch.server.mtx.Unlock()
+	ch.Event("CHANNEL_DESTROY", headers)
+}
+
+//CompleteExecute sends CHANNEL_EXECUTE_COMPLETE of cmd, headers are added to event e.g. variables set by the app
+func (ch *Channel) CompleteExecute(cmd Command, headers map[string]string) {
+	h := cmd.appHeaders()
+	h["Application-Response"] = "_none_"
+	for k, v := range headers {
+		h[k] = v
+	}
+	ch.Event("CHANNEL_EXECUTE_COMPLETE", h)
+}
+
+//Live reports if channel is not hungup
+func (ch *Channel) Live() bool {
+	ch.server.mtx.Lock()
+	defer ch.server.mtx.Unlock()
+	return ch.server.channels[ch.UUID] != nil
+}
+
+//Executes returns sendmsg executes received for channel in order
+func (ch *Channel) Executes() []Command {
+	var result []Command
+	for _, c := range ch.server.Commands() {
+		if c.Line == "sendmsg "+ch.UUID && c.App() != "" {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+//Apps returns applications executed on channel in order
+func (ch *Channel) Apps() []string {
+	var result []string
+	for _, c := range ch.Executes() {
+		result = append(result, c.App())
+	}
+	return result
+}
+
+//WaitExecute waits until app is executed on channel and returns the first execute of it
+func (ch *Channel) WaitExecute(app string, timeout time.Duration) (Command, error) {
+	var found Command
+	err := ch.server.wait(timeout, func() bool {
+		for _, c := range ch.server.commands {
+			if c.Line == "sendmsg "+ch.UUID && c.App() == app {
+				found = c
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return found, fmt.Errorf("%s not executed on %s: %s", app, ch.UUID, err)
+	}
+	return found, nil
+}
+
+//WaitHangup waits until channel is hungup
+func (ch *Channel) WaitHangup(timeout time.Duration) error {
+	err := ch.server.wait(timeout, func() bool {
+		return ch.server.channels[ch.UUID] == nil
+	})
+	if err != nil {
+		return fmt.Errorf("channel %s not hungup: %s", ch.UUID, err)
+	}
+	return nil
+}
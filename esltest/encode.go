@@ -0,0 +1,76 @@
+package esltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+//encodeJSON encodes event the way freeswitch does for "events json", body goes to _body
+func encodeJSON(headers map[string]string, body string) string {
+	m := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		m[k] = v
+	}
+	if body != "" {
+		m["Content-Length"] = strconv.Itoa(len(body))
+		m["_body"] = body
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+//encodePlain encodes event the way freeswitch does for "events plain"
+func encodePlain(headers map[string]string, body string) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(headers) {
+		b.WriteString(k + ": " + urlEncode(headers[k]) + "\n")
+	}
+	if body != "" {
+		b.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\n\n" + body)
+	} else {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+//encodeXML encodes event the way freeswitch does for "events xml", items of array headers are repeated elements
+func encodeXML(headers map[string]string, body string) string {
+	var b bytes.Buffer
+	b.WriteString("<event>\n  <headers>\n")
+	for _, k := range sortedKeys(headers) {
+		for _, v := range goesl.DecodeArrayHeader(headers[k]) {
+			b.WriteString("    <" + k + ">")
+			xml.EscapeText(&b, []byte(urlEncode(v)))
+			b.WriteString("</" + k + ">\n")
+		}
+	}
+	b.WriteString("  </headers>\n")
+	if body != "" {
+		b.WriteString("  <body>")
+		xml.EscapeText(&b, []byte(body))
+		b.WriteString("</body>\n")
+	}
+	b.WriteString("</event>")
+	return b.String()
+}
+
+//urlEncode encodes header value like freeswitch, spaces are %20 and + is %2B
+func urlEncode(v string) string {
+	return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
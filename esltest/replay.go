@@ -0,0 +1,180 @@
+package esltest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+//ReplayResult is outcome of Replay
+type ReplayResult struct {
+	//Commands are commands sent by the app during replay, auth included
+	Commands []Command
+	//Mismatches describe commands which were sent differently from the trace or not sent at all
+	Mismatches []string
+}
+
+//Replay feeds inbound traffic of one traced connection (see goesl.TraceWriter and goesl.SplitTrace) to apps
+//created by factory through a new eslsession.SessionManager, so a recorded call can be reproduced offline.
+//Traces do not keep the password, the client authenticates with password and the traced reply is sent to it.
+//
+//Replay is deterministic: traffic received after the n-th command in trace is sent only after the app
+//sends its n-th command. Event-UUID and Job-UUID of commands are mapped from trace to the live ones so
+//execute and job results reach the app. If the app does not send an expected command within timeout,
+//replay stops. Returns when trace is exhausted and the manager stops serving
+func Replay(records []goesl.TraceRecord, password string, factory eslsession.EslAppFactory, timeout time.Duration) (*ReplayResult, error) {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	segments, expected, err := splitReplay(records)
+	if err != nil {
+		return nil, err
+	}
+	if len(expected) == 0 || !strings.HasPrefix(expected[0].Line, "auth ") {
+		return nil, fmt.Errorf("trace does not start with auth")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+
+	result := &ReplayResult{}
+	replayed := make(chan struct{})
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		defer close(replayed)
+		nc, err := ln.Accept()
+		if err != nil {
+			result.Mismatches = append(result.Mismatches, err.Error())
+			return
+		}
+		defer nc.Close()
+		accepted <- nc
+		replay(nc, segments, expected, timeout, result)
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	client, err := goesl.NewClient(addr.IP.String(), uint(addr.Port), password, int(timeout/time.Second)+1)
+	if err != nil { //server is needed for auth so it is already running, stop it before returning
+		ln.Close()
+		select {
+		case nc := <-accepted:
+			nc.Close()
+		case <-replayed:
+		}
+		<-replayed
+		return nil, err
+	}
+	defer client.Close()
+	go client.Handle()
+
+	eslsession.NewSessionManager(&adapters.EslWrapper{Client: client}).Serve(factory)
+	<-replayed
+	return result, nil
+}
+
+//replay serves one client, segments[i] is sent after i-th command is received
+func replay(nc net.Conn, segments [][]byte, expected []Command, timeout time.Duration, result *ReplayResult) {
+	uuids := make(map[string]string) //trace uuid -> live uuid
+	rewrite := func(b []byte) []byte {
+		//uuids have the same length so Content-Length headers stay valid
+		for traced, live := range uuids {
+			b = bytes.ReplaceAll(b, []byte(traced), []byte(live))
+		}
+		return b
+	}
+
+	commands := make(chan Command)
+	go func() {
+		defer close(commands)
+		r := bufio.NewReader(nc)
+		tr := textproto.NewReader(r)
+		for {
+			cmd, err := readCommand(r, tr)
+			if err != nil {
+				return
+			}
+			commands <- cmd
+		}
+	}()
+
+	nc.Write(segments[0])
+	for i, want := range expected {
+		var got Command
+		var ok bool
+		select {
+		case got, ok = <-commands:
+		case <-time.After(timeout):
+		}
+		if !ok {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("command %d not sent: %s", i+1, want.Line))
+			return
+		}
+		result.Commands = append(result.Commands, got)
+		for _, h := range []string{"Event-UUID", "Job-UUID"} {
+			if traced, live := want.Headers.Get(h), got.Headers.Get(h); traced != "" && live != "" && len(traced) == len(live) {
+				uuids[traced] = live
+			}
+		}
+		if diff := compareCommands(want, got, rewrite); diff != "" {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("command %d: %s", i+1, diff))
+		}
+		nc.Write(rewrite(segments[i+1]))
+	}
+}
+
+//compareCommands returns difference of command line and executed app of commands
+func compareCommands(want Command, got Command, rewrite func([]byte) []byte) string {
+	wantLine, gotLine := string(rewrite([]byte(want.Line))), got.Line
+	if strings.HasPrefix(wantLine, "auth ") {
+		return ""
+	}
+	if wantLine != gotLine {
+		return fmt.Sprintf("expected %q, got %q", wantLine, gotLine)
+	}
+	wantApp := want.App() + " " + string(rewrite([]byte(want.AppArg())))
+	if gotApp := got.App() + " " + got.AppArg(); wantApp != gotApp {
+		return fmt.Sprintf("expected execute %q, got %q", wantApp, gotApp)
+	}
+	return ""
+}
+
+//splitReplay splits trace into commands sent by client and inbound traffic before and after each of them
+func splitReplay(records []goesl.TraceRecord) ([][]byte, []Command, error) {
+	segments := [][]byte{nil}
+	var expected []Command
+	for i, rec := range records {
+		if rec.Conn != records[0].Conn {
+			return nil, nil, fmt.Errorf("trace has records of several connections, use goesl.SplitTrace")
+		}
+		if rec.Direction == goesl.TraceIn {
+			segments[len(segments)-1] = append(segments[len(segments)-1], rec.Data...)
+			continue
+		}
+		r := bufio.NewReader(bytes.NewReader(rec.Data))
+		tr := textproto.NewReader(r)
+		for {
+			cmd, err := readCommand(r, tr)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid command in record %d: %s", i+1, err)
+			}
+			expected = append(expected, cmd)
+			segments = append(segments, nil)
+		}
+	}
+	return segments, expected, nil
+}
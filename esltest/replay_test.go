@@ -0,0 +1,133 @@
+package esltest_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+//record runs run on one parked channel with a traced client and returns the trace
+func record(t *testing.T, run func(s fs.ISession)) []goesl.TraceRecord {
+	t.Helper()
+	s, err := esltest.NewServer("ClueCon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.HandleExecute("read", func(ch *esltest.Channel, cmd esltest.Command) {
+		ch.CompleteExecute(cmd, map[string]string{"variable_digit": "7"})
+	})
+	buf := &bytes.Buffer{}
+	client, err := goesl.NewTracedClient(s.Host(), s.Port(), "ClueCon", 3, goesl.NewTraceWriter(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	served := make(chan error, 1)
+	go func() {
+		served <- eslsession.NewSessionManager(&adapters.EslWrapper{Client: client}).Serve(factory(run))
+	}()
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+	if err := ch.WaitHangup(0); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	<-served
+
+	records, err := goesl.ReadTrace(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := goesl.SplitTrace(records)
+	if len(conns) != 1 {
+		t.Fatalf("expected one traced connection, got %d", len(conns))
+	}
+	for _, rec := range conns["1"] {
+		if bytes.Contains(rec.Data, []byte("ClueCon")) {
+			t.Fatalf("password is traced in %q", rec.Data)
+		}
+	}
+	return conns["1"]
+}
+
+func TestReplay(t *testing.T) {
+	digits := make(chan string, 2)
+	run := func(s fs.ISession) {
+		s.Answer()
+		e, err := s.Exec("read", "1 1 prompt.wav digit 3000 #")
+		if err == nil {
+			digits <- e.GetHeader("variable_digit")
+		}
+		s.ExecBgAPI("status")
+		s.Hangup()
+	}
+	trace := record(t, run)
+	if d := <-digits; d != "7" {
+		t.Fatalf("expected digit 7 while recording, got %q", d)
+	}
+
+	result, err := esltest.Replay(trace, "ClueCon", factory(run), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Mismatches) != 0 {
+		t.Errorf("unexpected mismatches %v", result.Mismatches)
+	}
+	select {
+	case d := <-digits:
+		if d != "7" {
+			t.Errorf("expected replayed digit 7, got %q", d)
+		}
+	default:
+		t.Error("read did not complete during replay")
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	trace := record(t, func(s fs.ISession) {
+		s.Answer()
+		s.Playback("welcome.wav")
+		s.Hangup()
+	})
+	result, err := esltest.Replay(trace, "ClueCon", factory(func(s fs.ISession) {
+		s.Answer()
+		s.Playback("goodbye.wav")
+		s.Hangup()
+	}), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Mismatches) == 0 {
+		t.Error("expected playback mismatch")
+	}
+}
+
+func TestReplayAuthRejected(t *testing.T) {
+	trace := []goesl.TraceRecord{
+		{Conn: "1", Direction: goesl.TraceIn, Data: []byte("Content-Type: auth/request\n\n")},
+		{Conn: "1", Direction: goesl.TraceOut, Data: []byte("auth [redacted]\r\n\r\n")},
+		{Conn: "1", Direction: goesl.TraceIn, Data: []byte("Content-Type: command/reply\nReply-Text: -ERR invalid\n\n")},
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := esltest.Replay(trace, "ClueCon", factory(func(fs.ISession) {}), time.Second)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("replay with rejected auth succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay did not return")
+	}
+}
@@ -0,0 +1,546 @@
+//Package esltest provides a fake freeswitch event socket server which speaks the inbound esl protocol,
+//so apps and eslsession can be tested without a running switch.
+//
+//Tests connect a goesl client to Server, create channels with NewChannel and drive their lifecycle
+//(Park, Answer, Hangup). Every sendmsg execute is completed with CHANNEL_EXECUTE and
+//CHANNEL_EXECUTE_COMPLETE unless a handler is registered for the application with HandleExecute.
+//Received commands are recorded and can be asserted with Commands, Channel.Executes and the Wait methods
+package esltest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var originationUUID = regexp.MustCompile(`[{,]origination_uuid=([^,}]+)`)
+
+//DefaultTimeout used by wait methods when timeout is 0
+var DefaultTimeout = 5 * time.Second
+
+//APIHandler builds response body of api and bgapi commands, cmd is the command without api/bgapi prefix
+type APIHandler func(cmd string) string
+
+//ExecuteHandler is called on connection goroutine after an execute is received for app of ch.
+//It must not block, it completes the execute by calling ch.CompleteExecute now or later from another goroutine
+type ExecuteHandler func(ch *Channel, cmd Command)
+
+//Server is a fake freeswitch accepting inbound esl connections on a local port
+type Server struct {
+	password string
+	ln       net.Listener
+
+	mtx         sync.Mutex
+	conns       map[*conn]bool
+	channels    map[string]*Channel
+	commands    []Command
+	apiHandler  APIHandler
+	execHandler map[string]ExecuteHandler
+	changed     chan struct{} //closed and replaced whenever state checked by wait methods changes
+}
+
+//NewServer starts a server on a random local port which accepts clients authenticating with password
+func NewServer(password string) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		password:    password,
+		ln:          ln,
+		conns:       make(map[*conn]bool),
+		channels:    make(map[string]*Channel),
+		execHandler: make(map[string]ExecuteHandler),
+		changed:     make(chan struct{}),
+	}
+	go s.accept()
+	return s, nil
+}
+
+//Addr returns host:port server listens on
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+//Host returns host to pass to goesl.NewClient
+func (s *Server) Host() string {
+	return s.ln.Addr().(*net.TCPAddr).IP.String()
+}
+
+//Port returns port to pass to goesl.NewClient
+func (s *Server) Port() uint {
+	return uint(s.ln.Addr().(*net.TCPAddr).Port)
+}
+
+//Close stops accepting clients and closes connected ones
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.Disconnect()
+	return err
+}
+
+//Disconnect closes connected clients and keeps accepting new ones, like a restarted switch
+func (s *Server) Disconnect() {
+	s.mtx.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mtx.Unlock()
+	for _, c := range conns {
+		c.close()
+	}
+}
+
+//HandleAPI sets handler of api and bgapi commands. Without a handler "show channels as json" lists live
+//channels, originate creates an answered channel and other commands are answered with +OK
+func (s *Server) HandleAPI(h APIHandler) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.apiHandler = h
+}
+
+//HandleExecute sets handler of executes of app, nil restores automatic completion
+func (s *Server) HandleExecute(app string, h ExecuteHandler) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if h == nil {
+		delete(s.execHandler, app)
+		return
+	}
+	s.execHandler[app] = h
+}
+
+//Commands returns every command received after authentication in order
+func (s *Server) Commands() []Command {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]Command(nil), s.commands...)
+}
+
+//WaitCommand waits until a command whose first line starts with prefix is received and handled
+func (s *Server) WaitCommand(prefix string, timeout time.Duration) (Command, error) {
+	var found Command
+	err := s.wait(timeout, func() bool {
+		for _, c := range s.commands {
+			if strings.HasPrefix(c.Line, prefix) {
+				found = c
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return found, fmt.Errorf("command %q not received: %s", prefix, err)
+	}
+	return found, nil
+}
+
+//WaitSubscribed waits until a client subscribes to events, events emitted before that are lost like on a real switch
+func (s *Server) WaitSubscribed(timeout time.Duration) error {
+	err := s.wait(timeout, func() bool {
+		for c := range s.conns {
+			if c.format != "" {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return fmt.Errorf("no client subscribed to events: %s", err)
+	}
+	return nil
+}
+
+//NewChannel creates a live channel, vars are sent with its events as variable_ headers
+func (s *Server) NewChannel(vars map[string]string) *Channel {
+	ch := &Channel{
+		UUID:   uuid.New().String(),
+		server: s,
+		vars:   make(map[string]string),
+	}
+	for k, v := range vars {
+		ch.vars[k] = v
+	}
+	s.mtx.Lock()
+	s.channels[ch.UUID] = ch
+	s.mtx.Unlock()
+	return ch
+}
+
+//Event sends an event to every subscribed client, Event-Name is taken from headers and
+//body is sent as event body if not empty
+func (s *Server) Event(headers map[string]string, body string) {
+	s.mtx.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mtx.Unlock()
+	for _, c := range conns {
+		c.event(headers, body)
+	}
+}
+
+//wait checks cond under lock every time state changes until it is true or timeout passes
+func (s *Server) wait(timeout time.Duration, cond func() bool) error {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mtx.Lock()
+		ok := cond()
+		changed := s.changed
+		s.mtx.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return fmt.Errorf("timeout after %s", timeout)
+		}
+	}
+}
+
+//notify wakes up waiters, must be called with mtx held
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) accept() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{server: s, nc: nc}
+		s.mtx.Lock()
+		s.conns[c] = true
+		s.mtx.Unlock()
+		go c.serve()
+	}
+}
+
+func (s *Server) record(cmd Command) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.commands = append(s.commands, cmd)
+	s.notify()
+}
+
+func (s *Server) api(cmd string) string {
+	s.mtx.Lock()
+	h := s.apiHandler
+	s.mtx.Unlock()
+	if h != nil {
+		return h(cmd)
+	}
+	if cmd == "show channels as json" {
+		return s.showChannels()
+	}
+	if strings.HasPrefix(cmd, "originate ") {
+		return s.originate(cmd)
+	}
+	return "+OK"
+}
+
+//originate creates a channel with origination_uuid of cmd, answers and parks it like "originate ... &park()"
+func (s *Server) originate(cmd string) string {
+	ch := s.NewChannel(nil)
+	if m := originationUUID.FindStringSubmatch(cmd); m != nil {
+		s.mtx.Lock()
+		delete(s.channels, ch.UUID)
+		ch.UUID = m[1]
+		s.channels[ch.UUID] = ch
+		s.mtx.Unlock()
+	}
+	ch.Answer()
+	ch.Park()
+	return "+OK " + ch.UUID + "\n"
+}
+
+//showChannels formats live channels like "show channels as json"
+func (s *Server) showChannels() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	rows := make([]string, 0, len(s.channels))
+	for id := range s.channels {
+		rows = append(rows, fmt.Sprintf(`{"uuid":%q}`, id))
+	}
+	return fmt.Sprintf(`{"row_count":%d,"rows":[%s]}`, len(rows), strings.Join(rows, ","))
+}
+
+func (s *Server) execute(ch *Channel, cmd Command) {
+	s.mtx.Lock()
+	h := s.execHandler[cmd.App()]
+	s.mtx.Unlock()
+	ch.Event("CHANNEL_EXECUTE", cmd.appHeaders())
+	if h != nil {
+		h(ch, cmd)
+		return
+	}
+	ch.CompleteExecute(cmd, nil)
+	if cmd.App() == "hangup" {
+		cause := cmd.AppArg()
+		if cause == "" {
+			cause = "NORMAL_CLEARING"
+		}
+		ch.Hangup(cause)
+	}
+}
+
+//conn is one authenticated or authenticating client
+type conn struct {
+	server *Server
+	nc     net.Conn
+
+	writeMtx sync.Mutex
+	//format, events and subclasses of CUSTOM events are guarded by server mtx
+	format     string
+	events     map[string]bool
+	subclasses map[string]bool
+}
+
+func (c *conn) close() {
+	c.nc.Close()
+}
+
+func (c *conn) serve() {
+	defer func() {
+		c.nc.Close()
+		c.server.mtx.Lock()
+		delete(c.server.conns, c)
+		c.server.notify()
+		c.server.mtx.Unlock()
+	}()
+
+	c.write("Content-Type: auth/request\n\n")
+	r := bufio.NewReader(c.nc)
+	tr := textproto.NewReader(r)
+	authenticated := false
+	for {
+		cmd, err := readCommand(r, tr)
+		if err != nil {
+			return
+		}
+		if !authenticated {
+			if cmd.Line == "auth "+c.server.password {
+				authenticated = true
+				c.reply("+OK accepted")
+				continue
+			}
+			c.reply("-ERR invalid")
+			if strings.HasPrefix(cmd.Line, "auth ") {
+				return
+			}
+			continue
+		}
+		ok := c.handle(cmd)
+		c.server.record(cmd) //after handling so waiters see its effect, e.g. a subscription
+		if !ok {
+			return
+		}
+	}
+}
+
+//handle answers cmd, returns false if connection must be closed
+func (c *conn) handle(cmd Command) bool {
+	name, args := cmd.Line, ""
+	if i := strings.Index(cmd.Line, " "); i >= 0 {
+		name, args = cmd.Line[:i], cmd.Line[i+1:]
+	}
+	switch name {
+	case "api":
+		c.apiResponse(c.server.api(args))
+	case "bgapi":
+		jobUUID := cmd.Headers.Get("Job-UUID")
+		if jobUUID == "" {
+			jobUUID = uuid.New().String()
+		}
+		c.reply("+OK Job-UUID: " + jobUUID)
+		jobCmd, jobArg := args, ""
+		if i := strings.Index(args, " "); i >= 0 {
+			jobCmd, jobArg = args[:i], args[i+1:]
+		}
+		c.server.Event(map[string]string{
+			"Event-Name":      "BACKGROUND_JOB",
+			"Job-UUID":        jobUUID,
+			"Job-Command":     jobCmd,
+			"Job-Command-Arg": jobArg,
+		}, c.server.api(args))
+	case "event", "events":
+		fields := strings.Fields(args)
+		if len(fields) == 0 {
+			c.reply("-ERR missing event format")
+			break
+		}
+		c.subscribe(fields[0], fields[1:])
+		c.reply("+OK event listener enabled " + fields[0])
+	case "nixevent":
+		c.unsubscribe(strings.Fields(args))
+		c.reply("+OK events nixed")
+	case "noevents":
+		c.unsubscribe(nil)
+		c.reply("+OK no longer listening for events")
+	case "sendmsg":
+		c.server.mtx.Lock()
+		ch := c.server.channels[args]
+		c.server.mtx.Unlock()
+		if ch == nil {
+			c.reply("-ERR invalid session id [" + args + "]")
+			break
+		}
+		c.reply("+OK")
+		if strings.EqualFold(cmd.Headers.Get("Call-Command"), "execute") {
+			c.server.execute(ch, cmd)
+		}
+	case "exit":
+		c.reply("+OK bye")
+		c.write("Content-Type: text/disconnect-notice\nContent-Length: 0\n\n")
+		return false
+	case "filter", "linger", "nolinger", "myevents", "sendevent", "divert_events", "log", "nolog":
+		c.reply("+OK")
+	default:
+		c.reply("-ERR command not found")
+	}
+	return true
+}
+
+//subscribe adds events to subscribed ones and sets format of all like freeswitch. Events following CUSTOM
+//are its subclasses, CUSTOM alone subscribes every custom event
+func (c *conn) subscribe(format string, events []string) {
+	c.server.mtx.Lock()
+	defer c.server.mtx.Unlock()
+	c.format = format
+	if c.events == nil {
+		c.events = make(map[string]bool, len(events))
+		c.subclasses = make(map[string]bool)
+	}
+	names, subclasses := splitCustom(events)
+	for _, e := range names {
+		c.events[e] = true
+	}
+	for _, e := range subclasses {
+		c.subclasses[e] = true
+	}
+	c.server.notify()
+}
+
+//unsubscribe removes events, nil or ALL stops listening
+func (c *conn) unsubscribe(events []string) {
+	c.server.mtx.Lock()
+	defer c.server.mtx.Unlock()
+	names, subclasses := splitCustom(events)
+	for _, e := range names {
+		if e == "ALL" {
+			events = nil
+			break
+		}
+		delete(c.events, e)
+	}
+	for _, e := range subclasses {
+		delete(c.subclasses, e)
+	}
+	if events == nil {
+		c.format, c.events, c.subclasses = "", nil, nil
+	}
+	c.server.notify()
+}
+
+//wants reports if subscriptions match event, must be called holding server mtx
+func (c *conn) wants(headers map[string]string) bool {
+	name := headers["Event-Name"]
+	if c.events["ALL"] || c.events[name] {
+		return true
+	}
+	return name == "CUSTOM" && c.subclasses[headers["Event-Subclass"]]
+}
+
+//splitCustom splits events to names and subclasses following CUSTOM, CUSTOM without subclasses is a name
+func splitCustom(events []string) (names []string, subclasses []string) {
+	for i, e := range events {
+		if e == "CUSTOM" && i < len(events)-1 {
+			return names, events[i+1:]
+		}
+		names = append(names, e)
+	}
+	return names, nil
+}
+
+func (c *conn) write(s string) {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	io.WriteString(c.nc, s)
+}
+
+func (c *conn) reply(text string) {
+	c.write("Content-Type: command/reply\nReply-Text: " + text + "\n\n")
+}
+
+func (c *conn) apiResponse(body string) {
+	c.write("Content-Type: api/response\nContent-Length: " + strconv.Itoa(len(body)) + "\n\n" + body)
+}
+
+//event writes event if client is subscribed to it in the format it asked for
+func (c *conn) event(headers map[string]string, body string) {
+	c.server.mtx.Lock()
+	format := c.format
+	wanted := c.wants(headers)
+	c.server.mtx.Unlock()
+	if format == "" || !wanted {
+		return
+	}
+	var content string
+	switch format {
+	case "plain":
+		content = encodePlain(headers, body)
+	case "xml":
+		content = encodeXML(headers, body)
+	default:
+		format = "json"
+		content = encodeJSON(headers, body)
+	}
+	c.write("Content-Length: " + strconv.Itoa(len(content)) + "\nContent-Type: text/event-" + format + "\n\n" + content)
+}
+
+//readCommand reads command line, its headers and body if it has content-length
+func readCommand(r *bufio.Reader, tr *textproto.Reader) (Command, error) {
+	var cmd Command
+	line, err := tr.ReadLine()
+	for err == nil && line == "" {
+		line, err = tr.ReadLine()
+	}
+	if err != nil {
+		return cmd, err
+	}
+	cmd.Line = line
+	cmd.Headers, err = tr.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return cmd, err
+	}
+	if l := cmd.Headers.Get("Content-Length"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil {
+			return cmd, err
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return cmd, err
+		}
+		cmd.Body = string(body)
+	}
+	return cmd, nil
+}
@@ -0,0 +1,233 @@
+package esltest_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+//funcApp runs run on every parked channel
+type funcApp struct {
+	session fs.ISession
+	run     func(s fs.ISession)
+}
+
+func (app *funcApp) IsApplicable(event fs.IEvent) bool { return true }
+func (app *funcApp) Setup(event fs.IEvent)             {}
+func (app *funcApp) Run()                              { app.run(app.session) }
+
+func factory(run func(s fs.ISession)) eslsession.EslAppFactory {
+	return func(s fs.ISession) eslsession.IEslApp {
+		return &funcApp{session: s, run: run}
+	}
+}
+
+//start connects a manager to a new fake server and serves it with format events until test ends
+func start(t *testing.T, format string, run func(s fs.ISession)) (*esltest.Server, *eslsession.SessionManager) {
+	t.Helper()
+	s, err := esltest.NewServer("ClueCon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	go client.Handle()
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+	if err := m.SetEventFormat(format); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- m.Serve(factory(run)) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-served; !errors.Is(err, fs.ErrConnectionLost) {
+			t.Errorf("expected connection lost from Serve, got %v", err)
+		}
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	return s, m
+}
+
+func TestMain(m *testing.M) {
+	goesl.SetLogLevel(l.ERROR)
+	eslsession.SetLogLevel(l.ERROR)
+	os.Exit(m.Run())
+}
+
+func TestAppLifecycle(t *testing.T) {
+	for _, format := range []string{eslsession.EventFormatJSON, eslsession.EventFormatPlain, eslsession.EventFormatXML} {
+		t.Run(format, func(t *testing.T) {
+			errs := make(chan error, 4)
+			caller := make(chan string, 1)
+			s, _ := start(t, format, func(s fs.ISession) {
+				e, err1 := s.Answer()
+				if e != nil {
+					caller <- e.GetHeader("variable_caller")
+				}
+				_, err2 := s.Set("greeting", "hello world")
+				_, err3 := s.Playback("ivr/welcome.wav")
+				_, err4 := s.Hangup()
+				errs <- err1
+				errs <- err2
+				errs <- err3
+				errs <- err4
+			})
+			ch := s.NewChannel(map[string]string{"esl_manage": "true", "caller": "+1555 <a&b> 100%"})
+			ch.Park()
+			if err := ch.WaitHangup(0); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 4; i++ {
+				if err := <-errs; err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			}
+			if v := <-caller; v != "+1555 <a&b> 100%" {
+				t.Errorf("variable is not decoded %q", v)
+			}
+			if apps := ch.Apps(); !reflect.DeepEqual(apps, []string{"answer", "set", "playback", "hangup"}) {
+				t.Errorf("unexpected apps %v", apps)
+			}
+			if arg := ch.Executes()[1].AppArg(); arg != "greeting=hello world" {
+				t.Errorf("unexpected set argument %q", arg)
+			}
+		})
+	}
+}
+
+func TestHangupWhileExecuting(t *testing.T) {
+	result := make(chan error, 1)
+	s, _ := start(t, eslsession.EventFormatJSON, func(s fs.ISession) {
+		_, err := s.Playback("long.wav")
+		result <- err
+	})
+	s.HandleExecute("playback", func(ch *esltest.Channel, cmd esltest.Command) {}) //never completes
+
+	ch := s.NewChannel(nil)
+	ch.Park()
+	if _, err := ch.WaitExecute("playback", 0); err != nil {
+		t.Fatal(err)
+	}
+	ch.Hangup("ORIGINATOR_CANCEL")
+
+	select {
+	case err := <-result:
+		var closed *fs.ChannelClosedError
+		if !errors.As(err, &closed) || closed.HangupCause != "ORIGINATOR_CANCEL" {
+			t.Errorf("expected channel closed by ORIGINATOR_CANCEL, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("playback did not return after hangup")
+	}
+}
+
+func TestExecuteHandlerVariables(t *testing.T) {
+	result := make(chan string, 1)
+	s, _ := start(t, eslsession.EventFormatJSON, func(s fs.ISession) {
+		e, err := s.Exec("read", "1 1 prompt.wav digit 3000 #")
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		result <- e.GetHeader("variable_digit")
+	})
+	s.HandleExecute("read", func(ch *esltest.Channel, cmd esltest.Command) {
+		go ch.CompleteExecute(cmd, map[string]string{"variable_digit": "5"})
+	})
+
+	s.NewChannel(nil).Park()
+	select {
+	case digit := <-result:
+		if digit != "5" {
+			t.Errorf("expected digit 5, got %q", digit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read did not complete")
+	}
+}
+
+func TestAPIAndBgAPI(t *testing.T) {
+	s, m := start(t, eslsession.EventFormatJSON, func(s fs.ISession) {})
+	s.HandleAPI(func(cmd string) string {
+		if cmd == "bad" {
+			return "-ERR bad command"
+		}
+		return "+OK " + cmd
+	})
+
+	if body, err := m.API("status"); err != nil || body != "+OK status" {
+		t.Errorf("unexpected api result %q %v", body, err)
+	}
+	if _, err := m.API("bad"); !errors.Is(err, fs.ErrCommandRejected) {
+		t.Errorf("expected rejected api, got %v", err)
+	}
+	if body, err := m.BgAPI("uptime", 5); err != nil || body != "+OK uptime" {
+		t.Errorf("unexpected bgapi result %q %v", body, err)
+	}
+	if _, err := s.WaitCommand("bgapi uptime", 0); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOriginate(t *testing.T) {
+	s, m := start(t, eslsession.EventFormatJSON, func(s fs.ISession) {})
+	played := make(chan error, 1)
+	channelUUID, err := m.Originate(eslsession.OriginateRequest{
+		DialString:     "user/1000",
+		CallerIDName:   "Support Line",
+		CallerIDNumber: "1000",
+		Timeout:        20,
+		Variables:      map[string]string{"campaign": "a,b", "origination_uuid": "mine"},
+	}, factory(func(s fs.ISession) {
+		_, err := s.Playback("ivr/welcome.wav")
+		played <- err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-played:
+		if err != nil {
+			t.Errorf("unexpected playback error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("app of originated channel did not run")
+	}
+
+	cmd, err := s.WaitCommand("bgapi originate ", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "bgapi originate {campaign=a\\,b,originate_timeout=20,origination_caller_id_name='Support Line'," +
+		"origination_caller_id_number=1000,origination_uuid=" + channelUUID + "}user/1000 &park()"
+	if cmd.Line != want {
+		t.Errorf("unexpected originate command\n%s\n%s", cmd.Line, want)
+	}
+}
+
+func TestOriginateFailure(t *testing.T) {
+	s, m := start(t, eslsession.EventFormatJSON, func(s fs.ISession) {})
+	s.HandleAPI(func(cmd string) string { return "-ERR USER_BUSY\n" })
+
+	_, err := m.Originate(eslsession.OriginateRequest{DialString: "user/1000"}, factory(func(s fs.ISession) {
+		t.Error("app must not run for failed originate")
+	}))
+	var oe *fs.OriginateError
+	if !errors.As(err, &oe) || oe.Cause != "USER_BUSY" || !errors.Is(err, fs.ErrOriginateFailed) {
+		t.Errorf("expected USER_BUSY originate error, got %v", err)
+	}
+}
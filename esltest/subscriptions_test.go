@@ -0,0 +1,120 @@
+package esltest_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+)
+
+//waitCommands waits until server received n commands and returns lines of commands after first
+func waitCommands(t *testing.T, s *esltest.Server, first int, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(esltest.DefaultTimeout)
+	for {
+		cmds := s.Commands()
+		if len(cmds) >= n {
+			var lines []string
+			for _, c := range cmds[first:] {
+				lines = append(lines, c.Line)
+			}
+			return lines
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d commands, expected %d", len(cmds), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	s, err := esltest.NewServer("ClueCon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	events := make(chan *goesl.Message, 16)
+	lost := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := client.ReadMessage()
+			if err != nil {
+				lost <- err
+				continue
+			}
+			if msg.GetType() == "text/event-json" {
+				events <- msg
+			}
+		}
+	}()
+
+	steps := []error{
+		client.Events("json", "CHANNEL_ANSWER", "DTMF", "CUSTOM", "conference::maniacs"),
+		client.Events("json", "CHANNEL_HANGUP"),
+		client.NixEvent("DTMF"),
+		client.Filter("Event-Name", "CHANNEL_ANSWER"),
+		client.Filter("Event-Name", "CHANNEL_HANGUP"),
+		client.FilterDelete("Event-Name", "CHANNEL_HANGUP"),
+		client.DivertEvents(true),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("step %d: %s", i, err)
+		}
+	}
+	if err := client.Events("yaml", "ALL"); err == nil {
+		t.Error("expected invalid format error")
+	}
+	want := goesl.Subscriptions{
+		Format:       "json",
+		Events:       []string{"CHANNEL_ANSWER", "CHANNEL_HANGUP"},
+		Subclasses:   []string{"conference::maniacs"},
+		Filters:      []goesl.EventFilter{{Header: "Event-Name", Value: "CHANNEL_ANSWER"}},
+		DivertEvents: true,
+	}
+	if subs := client.Subscriptions(); !reflect.DeepEqual(subs, want) {
+		t.Errorf("unexpected subscriptions\n%+v\n%+v", subs, want)
+	}
+	sent := waitCommands(t, s, 0, len(steps))
+	if sent[0] != "event json CHANNEL_ANSWER DTMF CUSTOM conference::maniacs" || sent[2] != "nixevent DTMF" ||
+		sent[5] != "filter delete Event-Name CHANNEL_HANGUP" {
+		t.Errorf("unexpected commands %q", sent)
+	}
+
+	s.Disconnect()
+	select {
+	case <-lost:
+	case <-time.After(esltest.DefaultTimeout):
+		t.Fatal("connection loss not reported")
+	}
+	if err := client.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	restored := waitCommands(t, s, len(steps), len(steps)+3)
+	wantRestored := []string{"event json CHANNEL_ANSWER CHANNEL_HANGUP CUSTOM conference::maniacs",
+		"filter Event-Name CHANNEL_ANSWER", "divert_events on"}
+	if !reflect.DeepEqual(restored, wantRestored) {
+		t.Errorf("unexpected commands after reconnect\n%q\n%q", restored, wantRestored)
+	}
+
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	s.Event(map[string]string{"Event-Name": "CHANNEL_ANSWER"}, "")
+	select {
+	case e := <-events:
+		if name := e.GetHeader("Event-Name"); name != "CHANNEL_ANSWER" {
+			t.Errorf("unexpected event %s", name)
+		}
+	case <-time.After(esltest.DefaultTimeout):
+		t.Fatal("event subscribed again was not received")
+	}
+}
@@ -0,0 +1,11 @@
+package fs
+
+//ConferenceOptions configures joining a conference by ISession.Conference, zero fields keep freeswitch defaults
+type ConferenceOptions struct {
+	//Profile is conference profile of conference.conf.xml, default profile is used if empty
+	Profile string
+	//PIN is pin of a protected conference, caller is not prompted for it
+	PIN string
+	//Flags are member flags e.g. mute, deaf, moderator, endconf or mintwo
+	Flags []string
+}
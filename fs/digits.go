@@ -0,0 +1,52 @@
+package fs
+
+import "time"
+
+//GetDigitsOptions configures ISession.GetDigits, zero fields take defaults
+type GetDigitsOptions struct {
+	//Min and Max digits of a valid input, default 1 and Min
+	Min int
+	Max int
+	//Tries is how many times prompt is played until a valid input, default 1
+	Tries int
+	//Timeout waits for first digit, default 5s. DigitTimeout waits between digits, default Timeout
+	Timeout      time.Duration
+	DigitTimeout time.Duration
+	//Terminators end input early, default "#", "none" disables them
+	Terminators string
+	//Prompt is played on each try, InvalidPrompt after an invalid input. Files, phrase: or say: are accepted
+	Prompt        string
+	InvalidPrompt string
+	//Regexp a valid input matches, default \d+
+	Regexp string
+	//TransferOnFailure is "extension [dialplan] [context]" channel is transferred to when tries are exhausted
+	TransferOnFailure string
+}
+
+//DigitsStatus tells how a digit collection ended
+type DigitsStatus string
+
+//digit collection statuses
+const (
+	//DigitsCollected valid input was entered
+	DigitsCollected DigitsStatus = "collected"
+	//DigitsInvalid input did not match Regexp or length limits in last try
+	DigitsInvalid DigitsStatus = "invalid"
+	//DigitsTimeout nothing was entered in last try
+	DigitsTimeout DigitsStatus = "timeout"
+)
+
+//GetDigitsResult is outcome of ISession.GetDigits
+type GetDigitsResult struct {
+	//Digits is valid input, empty unless Status is DigitsCollected
+	Digits string
+	//Invalid is last invalid input
+	Invalid string
+	//Terminator which ended valid input, empty if input was not terminated
+	Terminator string
+	Status     DigitsStatus
+	//Attempts is number of tries played
+	Attempts int
+	//Event is CHANNEL_EXECUTE_COMPLETE of last try
+	Event IEvent
+}
@@ -0,0 +1,103 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//sentinel errors, use errors.Is to check errors returned by sessions and clients against them
+var (
+	//ErrChannelClosed channel is hungup and destroyed or its session is closed
+	ErrChannelClosed = errors.New("channel closed")
+	//ErrCommandRejected freeswitch replied -ERR to a command or api
+	ErrCommandRejected = errors.New("command rejected")
+	//ErrTimeout operation did not complete in time
+	ErrTimeout = errors.New("timeout")
+	//ErrConnectionLost esl connection is closed or broken
+	ErrConnectionLost = errors.New("connection lost")
+	//ErrOriginateFailed outbound call could not be placed or was not answered
+	ErrOriginateFailed = errors.New("originate failed")
+)
+
+//ChannelClosedError is returned by operations on a destroyed channel, HangupCause is empty if it is not known
+type ChannelClosedError struct {
+	UUID        string
+	HangupCause string
+}
+
+func (e *ChannelClosedError) Error() string {
+	if e.HangupCause == "" {
+		return fmt.Sprintf("channel %s closed", e.UUID)
+	}
+	return fmt.Sprintf("channel %s closed: %s", e.UUID, e.HangupCause)
+}
+
+//Is makes errors.Is(err, ErrChannelClosed) true
+func (e *ChannelClosedError) Is(target error) bool {
+	return target == ErrChannelClosed
+}
+
+//CommandError is returned when freeswitch rejects a command, Reply is the reply text starting with -ERR
+type CommandError struct {
+	Command string
+	Reply   string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Reply)
+}
+
+//Is makes errors.Is(err, ErrCommandRejected) true
+func (e *CommandError) Is(target error) bool {
+	return target == ErrCommandRejected
+}
+
+//TimeoutError is returned when an operation like a background job does not complete in time
+type TimeoutError struct {
+	Op      string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Op, e.Timeout)
+}
+
+//Is makes errors.Is(err, ErrTimeout) true
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+//ConnectionError wraps the error which broke esl connection
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("connection lost: %s", e.Err)
+}
+
+//Unwrap returns underlying error e.g. io.EOF
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+//Is makes errors.Is(err, ErrConnectionLost) true
+func (e *ConnectionError) Is(target error) bool {
+	return target == ErrConnectionLost
+}
+
+//OriginateError is returned when an originated call fails, Cause is freeswitch hangup cause like NO_ANSWER
+type OriginateError struct {
+	DialString string
+	Cause      string
+}
+
+func (e *OriginateError) Error() string {
+	return fmt.Sprintf("originate %s failed: %s", e.DialString, e.Cause)
+}
+
+//Is makes errors.Is(err, ErrOriginateFailed) true
+func (e *OriginateError) Is(target error) bool {
+	return target == ErrOriginateFailed
+}
@@ -1,8 +1,15 @@
 package fs
 
+import (
+	"context"
+	"time"
+)
+
 //IEvent is fs event
 type IEvent interface {
 	GetHeader(name string) string
+	//GetHeaderValues returns every value of multi value headers like variable_DP_MATCH, nil if header is missing
+	GetHeaderValues(name string) []string
 	GetBody() []byte
 	GetType() string
 }
@@ -12,14 +19,65 @@ type IEsl interface {
 	Send(cmd string) error
 	SendMsg(cmd map[string]string, uuid string, data string) error
 	BgAPI(cmd string, uuid string) error
+	//API runs api command and blocks until its response, -ERR responses are returned as error
+	API(cmd string) (string, error)
 	ReadMessage() (IEvent, error)
 }
 
+//IReconnectable is implemented by IEsl clients which can re-establish and re-authenticate their connection
+type IReconnectable interface {
+	Reconnect() error
+}
+
+//IEventSubscriber is implemented by IEsl clients which track their event subscriptions and restore them
+//after reconnecting. Methods wait for the reply, rejected commands are returned as CommandError and not tracked
+type IEventSubscriber interface {
+	//Events subscribes events in format (plain, json or xml), CUSTOM is followed by subclasses of custom events
+	Events(format string, events ...string) error
+	//NixEvent unsubscribes events
+	NixEvent(events ...string) error
+	//MyEvents subscribes every event of channel uuid, outbound connections pass empty uuid for their channel
+	MyEvents(format string, uuid string) error
+	//Linger keeps outbound connection open for seconds after hangup, 0 for freeswitch default
+	Linger(seconds int) error
+}
+
 // EventHandlerFunc a function to receive an event
 type EventHandlerFunc func(IEvent)
 
+//HandlerOption changes how an event handler is called
+type HandlerOption int
+
+const (
+	//HandleOnce removes handler after its first event
+	HandleOnce HandlerOption = iota + 1
+	//HandleSync calls handler on session dispatcher so it runs before the event is passed on, it must not
+	//block or call session operations. Other handlers run in order on one goroutine of session
+	HandleSync
+)
+
+//IEventHandle is returned by AddEventHandler to remove the handler
+type IEventHandle interface {
+	Remove()
+}
+
+//IEventWaiter receives an event expected by ISession.ExpectEvent
+type IEventWaiter interface {
+	//Wait blocks until event arrives or timeout passes, 0 waits without timeout
+	Wait(timeout time.Duration) (IEvent, error)
+	//Cancel stops waiting
+	Cancel()
+}
+
+//CustomEventName is name of CUSTOM events of subclass used to set their handlers, e.g. "CUSTOM conference::maniacs"
+func CustomEventName(subclass string) string {
+	return "CUSTOM " + subclass
+}
+
 //ISession is fs call interface
 type ISession interface {
+	//Exec runs any dialplan application, used when no dedicated wrapper exists
+	Exec(app string, args string) (IEvent, error)
 	Set(name string, value string) (IEvent, error)
 	Unset(name string) (IEvent, error)
 	MultiSet(variables map[string]string) (IEvent, error)
@@ -32,12 +90,51 @@ type ISession interface {
 		terminators string, file string, invalidFile string, varName string, regexp string, digitTimeout uint,
 		transferOnFailure string) (IEvent, error)
 	PlayAndGetOneDigit(path string) (uint64, error)
+	//GetDigits plays a prompt and collects digits, invalid input and timeout are reported by result
+	GetDigits(o GetDigitsOptions) (*GetDigitsResult, error)
+	//Record runs record application and returns the stopped recording
+	Record(path string, o RecordOptions) (IRecording, error)
+	//RecordSession starts recording channel in background with record_session
+	RecordSession(path string, o RecordOptions) (IRecording, error)
+	//UUIDRecord starts recording channel in background with uuid_record api
+	UUIDRecord(path string, o RecordOptions) (IRecording, error)
+	//ReadDigit returns next DTMF digit received by channel, "" if none arrives in timeout
+	ReadDigit(timeout time.Duration) (string, error)
+	//ReadDigits reads up to max DTMF digits until a terminator, timeout before first digit or interDigitTimeout
+	ReadDigits(max int, terminators string, timeout time.Duration, interDigitTimeout time.Duration) (string, error)
+	//FlushDigits drops buffered DTMF digits and returns them
+	FlushDigits() string
 	Bridge(bstr string) (IEvent, error)
 	Voicemail(settingsProfile string, domain string, username string) (IEvent, error)
+	//Conference joins channel to conference room and blocks until it leaves
+	Conference(room string, o ConferenceOptions) (IEvent, error)
 	//SendEvent fires event using channel execute
 	SendEvent(headers map[string]string) (IEvent, error)
 
 	ExecBgAPI(cmd string) (IEvent, error)
-	ExecAPI(cmd string) error
-	AddEventHandler(eventName string, handler EventHandlerFunc)
+	ExecAPI(cmd string) (string, error)
+	//AddEventHandler adds a handler of channel events named eventName, handlers of an event run in order of
+	//addition. CUSTOM events are handled by CustomEventName(subclass) handlers or else by CUSTOM handlers
+	AddEventHandler(eventName string, handler EventHandlerFunc, options ...HandlerOption) IEventHandle
+	//AddCustomEventHandler subscribes CUSTOM events of subclass and adds a handler of those of channel
+	AddCustomEventHandler(subclass string, handler EventHandlerFunc, options ...HandlerOption) (IEventHandle, error)
+	//ExpectEvent returns a waiter of the first channel event accepted by match which arrives from now on
+	ExpectEvent(match func(IEvent) bool) IEventWaiter
+	//WaitForEvent blocks until a channel event named one of names arrives or timeout passes, 0 waits without timeout
+	WaitForEvent(timeout time.Duration, names ...string) (IEvent, error)
+	//WaitForEventFunc blocks until a channel event accepted by match arrives or timeout passes
+	WaitForEventFunc(timeout time.Duration, match func(IEvent) bool) (IEvent, error)
+
+	//WithContext returns the same session with all blocking operations bound to ctx,
+	//cancelling ctx stops the running application and makes the operation return ctx.Err()
+	WithContext(ctx context.Context) ISession
+	//ExecContext same as Exec bound to ctx
+	ExecContext(ctx context.Context, app string, args string) (IEvent, error)
+	//Context returns context set by WithContext, background if none is set
+	Context() context.Context
+	//UUID returns uuid of managed channel
+	UUID() string
+	//Done is closed when channel is destroyed or connection is lost, Err tells why
+	Done() <-chan struct{}
+	Err() error
 }
@@ -0,0 +1,33 @@
+package fs
+
+import "time"
+
+//RecordOptions configures recordings of ISession, zero fields keep freeswitch defaults
+type RecordOptions struct {
+	//Limit is maximum length of recording, 0 for no limit
+	Limit time.Duration
+	//SilenceThreshold is energy level counted as silence and SilenceHits how many seconds of silence end
+	//recording, only record application supports them
+	SilenceThreshold int
+	SilenceHits      int
+	//Stereo records each leg in its own channel
+	Stereo bool
+	//Append appends to an existing file instead of replacing it
+	Append bool
+}
+
+//IRecording is a recording of a channel, its state is reported by RECORD_START and RECORD_STOP events
+type IRecording interface {
+	//Path is file path reported by freeswitch, the requested path until recording starts
+	Path() string
+	//Duration is length of a stopped recording or time since start of a running one
+	Duration() time.Duration
+	//Cause is Record-Completion-Cause of a stopped recording, e.g. success-silence or success-maxtime
+	Cause() string
+	//Done is closed when recording stops
+	Done() <-chan struct{}
+	//Wait blocks until recording stops or timeout passes, 0 waits without timeout
+	Wait(timeout time.Duration) error
+	//Stop stops recording, it does nothing for a stopped one
+	Stop() error
+}
@@ -28,24 +28,54 @@ type Client struct {
 	Addr    string `json:"freeswitch_addr"`
 	Passwd  string `json:"freeswitch_password"`
 	Timeout int    `json:"freeswitch_connection_timeout"`
+
+	// Trace - If set, traffic of every connection made by client is recorded to it
+	Trace *TraceWriter `json:"-"`
+}
+
+// dial - Will connect to freeswitch, connection is traced if Trace is set
+func (c *Client) dial() (net.Conn, error) {
+	conn, err := c.Dial(c.Proto, c.Addr, time.Duration(c.Timeout*int(time.Second)))
+	if err != nil {
+		return nil, err
+	}
+	if c.Trace != nil {
+		conn = c.Trace.Wrap(conn)
+	}
+	return conn, nil
 }
 
 // EstablishConnection - Will attempt to establish connection against freeswitch and create new SocketConnection
 func (c *Client) EstablishConnection() error {
-	conn, err := c.Dial(c.Proto, c.Addr, time.Duration(c.Timeout*int(time.Second)))
+	conn, err := c.dial()
 	if err != nil {
 		return err
 	}
 
-	c.SocketConnection = SocketConnection{
-		Conn: conn,
-		err:  make(chan error),
-		m:    make(chan *Message),
-	}
+	c.SocketConnection = newSocketConnection(conn)
 
 	return nil
 }
 
+// Reconnect - Will establish a new connection and authenticate again. Messages of new connection
+// are read by calling Handle again, ReadMessage callers keep reading from the same client.
+// Subscriptions made by subscription methods (Events, Filter, ...) are sent again, their replies are read by ReadMessage
+func (c *Client) Reconnect() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	c.reset(conn)
+
+	if err := c.Authenticate(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	return c.resubscribe()
+}
+
 // Authenticate - Method used to authenticate client against freeswitch. In case of any errors durring so
 // we will return error.
 func (c *Client) Authenticate() error {
@@ -92,11 +122,17 @@ func (c *Client) Authenticate() error {
 // NewClient - Will initiate new client that will establish connection and attempt to authenticate
 // against connected freeswitch server
 func NewClient(host string, port uint, passwd string, timeout int) (*Client, error) {
+	return NewTracedClient(host, port, passwd, timeout, nil)
+}
+
+// NewTracedClient - Same as NewClient but records traffic to trace, auth included. Trace may be nil
+func NewTracedClient(host string, port uint, passwd string, timeout int, trace *TraceWriter) (*Client, error) {
 	client := Client{
 		Proto:   "tcp", // Let me know if you ever need this open up lol
 		Addr:    net.JoinHostPort(host, strconv.Itoa(int(port))),
 		Passwd:  passwd,
 		Timeout: timeout,
+		Trace:   trace,
 	}
 
 	err := client.EstablishConnection()
@@ -10,7 +10,6 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"io"
 	"net"
 	"strconv"
 	"strings"
@@ -28,6 +27,98 @@ type SocketConnection struct {
 	err chan error
 	m   chan *Message
 	mtx sync.Mutex
+
+	//replies holds one slot per written command in write order, freeswitch answers commands in order
+	//so each command/reply or api/response belongs to the oldest slot. nil slots are not waited for
+	//and their replies are passed to ReadMessage as before
+	replies  []chan *Message
+	replyMtx sync.Mutex
+	link     *link
+
+	//subs is what subscription methods subscribed, reapplied by Client.Reconnect
+	subs    Subscriptions
+	subsMtx sync.Mutex
+}
+
+//link is state of one underlying net connection, it is replaced on reconnect
+type link struct {
+	conn net.Conn
+	//done is closed when Handle stops reading the connection, err tells why
+	done chan struct{}
+	err  error
+}
+
+func newLink(conn net.Conn) *link {
+	return &link{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+}
+
+func newSocketConnection(conn net.Conn) SocketConnection {
+	return SocketConnection{
+		Conn: conn,
+		err:  make(chan error),
+		m:    make(chan *Message),
+		link: newLink(conn),
+	}
+}
+
+//reset replaces underlying net connection keeping message channels so ReadMessage callers are not affected.
+//Replies pending on old connection are dropped, their waiters are released by old link being done
+func (c *SocketConnection) reset(conn net.Conn) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.replyMtx.Lock()
+	c.replies = nil
+	c.replyMtx.Unlock()
+	c.Conn = conn
+	c.link = newLink(conn)
+}
+
+//expectReply reserves reply slot of a command, must be called while holding mtx right before writing it
+func (c *SocketConnection) expectReply(waiter chan *Message) {
+	c.replyMtx.Lock()
+	defer c.replyMtx.Unlock()
+	c.replies = append(c.replies, waiter)
+}
+
+//dropReply gives up slot of a command which could not be written
+func (c *SocketConnection) dropReply() {
+	c.replyMtx.Lock()
+	defer c.replyMtx.Unlock()
+	if len(c.replies) > 0 {
+		c.replies = c.replies[:len(c.replies)-1]
+	}
+}
+
+//replyWaiter pops the slot a reply belongs to
+func (c *SocketConnection) replyWaiter() chan *Message {
+	c.replyMtx.Lock()
+	defer c.replyMtx.Unlock()
+	if len(c.replies) == 0 {
+		return nil
+	}
+	w := c.replies[0]
+	c.replies = c.replies[1:]
+	return w
+}
+
+//write sends a complete command and reserves its reply slot, returned link is the connection it was written to
+func (c *SocketConnection) write(b []byte, waiter chan *Message) (*link, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.expectReply(waiter)
+	if _, err := c.Write(b); err != nil {
+		c.dropReply()
+		return c.link, &ConnectionError{Err: err}
+	}
+	return c.link, nil
+}
+
+func (c *SocketConnection) send(b []byte) error {
+	_, err := c.write(b, nil)
+	return err
 }
 
 // Dial - Will establish timedout dial against specified address. In this case, it will be freeswitch server
@@ -42,27 +133,11 @@ func (c *SocketConnection) BgAPI(cmd string, uuid string) error {
 		return fmt.Errorf(EInvalidCommandProvided, cmd)
 	}
 
-	// lock mutex
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
-	_, err := io.WriteString(c, cmd)
-	if err != nil {
-		return err
-	}
-
 	if uuid != "" {
-		_, err := io.WriteString(c, "\r\nJob-UUID: "+uuid)
-		if err != nil {
-			return err
-		}
+		cmd += "\r\nJob-UUID: " + uuid
 	}
 
-	_, err = io.WriteString(c, "\r\n\r\n")
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.send([]byte(cmd + "\r\n\r\n"))
 }
 
 // Send - Will send raw message to open net connection
@@ -72,20 +147,31 @@ func (c *SocketConnection) Send(cmd string) error {
 		return fmt.Errorf(EInvalidCommandProvided, cmd)
 	}
 
-	// lock mutex
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
+	return c.send([]byte(cmd + "\r\n\r\n"))
+}
 
-	_, err := io.WriteString(c, cmd)
-	if err != nil {
-		return err
+// Request - Will send raw command and block until its command/reply or api/response is received.
+// -ERR replies are returned as *ReplyError along with the message
+func (c *SocketConnection) Request(cmd string) (*Message, error) {
+	if strings.Contains(cmd, "\r\n") {
+		return nil, fmt.Errorf(EInvalidCommandProvided, cmd)
 	}
 
-	_, err = io.WriteString(c, "\r\n\r\n")
+	waiter := make(chan *Message, 1)
+	lk, err := c.write([]byte(cmd+"\r\n\r\n"), waiter)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	select {
+	case msg := <-waiter:
+		if reply := msg.GetReplyText(); strings.HasPrefix(reply, "-ERR") {
+			return msg, &ReplyError{Command: cmd, Reply: reply}
+		}
+		return msg, nil
+	case <-lk.done:
+		return nil, lk.err
 	}
-	return nil
 }
 
 // SendMany - Will loop against passed commands and return 1st error if error happens
@@ -104,33 +190,15 @@ func (c *SocketConnection) SendEvent(eventHeaders []string) error {
 		return fmt.Errorf(ECouldNotSendEvent, len(eventHeaders))
 	}
 
-	// lock mutex to prevent event headers from conflicting
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
-	_, err := io.WriteString(c, "sendevent ")
-	if err != nil {
-		return err
-	}
-
+	b := bytes.NewBufferString("sendevent ")
 	for _, eventHeader := range eventHeaders {
-		_, err := io.WriteString(c, eventHeader)
-		if err != nil {
-			return err
-		}
-
-		_, err = io.WriteString(c, "\r\n")
-		if err != nil {
-			return err
-		}
-
+		b.WriteString(eventHeader)
+		b.WriteString("\r\n")
 	}
+	b.WriteString("\r\n")
 
-	_, err = io.WriteString(c, "\r\n")
-	if err != nil {
-		return err
-	}
-	return nil
+	// written at once to prevent event headers from conflicting
+	return c.send(b.Bytes())
 }
 
 // Execute - Helper fuck to execute commands with its args and sync/async mode
@@ -188,15 +256,7 @@ func (c *SocketConnection) SendMsg(msg map[string]string, uuid, data string) err
 		b.WriteString(data)
 	}
 
-	// lock mutex
-	c.mtx.Lock()
-	_, err := b.WriteTo(c)
-	if err != nil {
-		c.mtx.Unlock()
-		return err
-	}
-	c.mtx.Unlock()
-	return nil
+	return c.send(b.Bytes())
 }
 
 // OriginatorAddr - Will return originator address known as net.RemoteAddr()
@@ -223,17 +283,32 @@ func (c *SocketConnection) Handle() {
 
 	done := make(chan bool)
 
-	rbuf := bufio.NewReaderSize(c, ReadBufferSize)
+	// connection may be replaced by reconnect while this one is being closed, so stick to current one
+	c.mtx.Lock()
+	lk := c.link
+	c.mtx.Unlock()
+
+	rbuf := bufio.NewReaderSize(lk.conn, ReadBufferSize)
 
 	go func() {
 		for {
 			msg, err := newMessage(rbuf, true)
 			if err != nil {
+				err = &ConnectionError{Err: err}
+				lk.err = err
+				close(lk.done)
 				c.err <- err
 				done <- true
 				break
 			}
 
+			if t := msg.GetType(); t == "command/reply" || t == "api/response" {
+				if waiter := c.replyWaiter(); waiter != nil {
+					waiter <- msg
+					continue
+				}
+			}
+
 			c.m <- msg
 			connectionLogger.Debug("Handle() passed message")
 		}
@@ -242,7 +317,7 @@ func (c *SocketConnection) Handle() {
 	<-done
 
 	// Closing the connection now as there's nothing left to do ...
-	c.Close()
+	lk.conn.Close()
 	connectionLogger.Debug("!!!Main socket closed!!!")
 }
 
@@ -0,0 +1,183 @@
+package goesl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+//pipeServer is freeswitch side of a connection made by net.Pipe
+type pipeServer struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+//newPipe returns a handled connection and its freeswitch side
+func newPipe(t *testing.T) (*SocketConnection, *pipeServer) {
+	client, server := net.Pipe()
+	sc := newSocketConnection(client)
+	go sc.Handle()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return &sc, &pipeServer{conn: server, r: bufio.NewReader(server)}
+}
+
+//command reads next command and returns its first line
+func (p *pipeServer) command() (string, error) {
+	first := ""
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			return first, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return first, nil
+		}
+		if first == "" {
+			first = line
+		}
+	}
+}
+
+func (p *pipeServer) reply(text string) {
+	fmt.Fprintf(p.conn, "Content-Type: command/reply\nReply-Text: %s\n\n", text)
+}
+
+func (p *pipeServer) response(body string) {
+	fmt.Fprintf(p.conn, "Content-Type: api/response\nContent-Length: %d\n\n%s", len(body), body)
+}
+
+func receiveResult(t *testing.T, results chan error) error {
+	t.Helper()
+	select {
+	case err := <-results:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("request did not return")
+	}
+	return nil
+}
+
+func TestInterleavedAPIAndBgAPI(t *testing.T) {
+	c, p := newPipe(t)
+	apiRead := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			if _, err := p.command(); err != nil {
+				return
+			}
+			if i == 1 {
+				close(apiRead)
+			}
+		}
+		p.reply("+OK Job-UUID: job1")
+		p.response("UP 0 years, 0 days")
+		p.reply("+OK Job-UUID: job2")
+	}()
+
+	if err := c.BgAPI("status", "job1"); err != nil {
+		t.Fatal(err)
+	}
+	body := make(chan string, 1)
+	results := make(chan error, 1)
+	go func() {
+		b, err := c.API("status")
+		body <- b
+		results <- err
+	}()
+	<-apiRead
+	if err := c.BgAPI("status", "job2"); err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []string{"job1", "job2"} {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply := msg.GetReplyText(); reply != "+OK Job-UUID: "+job {
+			t.Errorf("unexpected bgapi reply %q", reply)
+		}
+	}
+	if err := receiveResult(t, results); err != nil {
+		t.Fatal(err)
+	}
+	if b := <-body; b != "UP 0 years, 0 days" {
+		t.Errorf("unexpected api response %q", b)
+	}
+}
+
+func TestRequestConnectionLost(t *testing.T) {
+	c, p := newPipe(t)
+	results := make(chan error, 1)
+	go func() {
+		_, err := c.Request("api status")
+		results <- err
+	}()
+	if _, err := p.command(); err != nil {
+		t.Fatal(err)
+	}
+	p.conn.Close()
+	if err := receiveResult(t, results); !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := c.ReadMessage(); !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("unexpected read error %v", err)
+	}
+}
+
+func TestResetDropsPendingReplies(t *testing.T) {
+	c, old := newPipe(t)
+	go func() { //a round trip makes sure Handle reads old connection before it is reset
+		if _, err := old.command(); err == nil {
+			old.response("+OK old")
+		}
+	}()
+	if _, err := c.API("status"); err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan error, 1)
+	go func() {
+		_, err := c.Request("api status")
+		results <- err
+	}()
+	if _, err := old.command(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c.reset(client)
+	c.replyMtx.Lock()
+	pending := len(c.replies)
+	c.replyMtx.Unlock()
+	if pending != 0 {
+		t.Fatalf("%d reply slots left after reset", pending)
+	}
+	go c.Handle()
+
+	old.conn.Close()
+	if err := receiveResult(t, results); !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("request on old connection returned %v", err)
+	}
+	if _, err := c.ReadMessage(); !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("unexpected read error %v", err)
+	}
+
+	p := &pipeServer{conn: server, r: bufio.NewReader(server)}
+	go func() {
+		if _, err := p.command(); err == nil {
+			p.response("+OK new")
+		}
+	}()
+	if b, err := c.API("status"); err != nil || b != "+OK new" {
+		t.Errorf("unexpected response on new connection %q %v", b, err)
+	}
+}
@@ -6,6 +6,11 @@
 
 package goesl
 
+import (
+	"errors"
+	"fmt"
+)
+
 var (
 	EInvalidCommandProvided  = "Invalid command provided. Command cannot contain \\r and/or \\n. Provided command is: %s"
 	ECouldNotReadMIMEHeaders = "Error while reading MIME headers: %s"
@@ -21,4 +26,47 @@ var (
 	EInvalidPassword         = "Could not authenticate against freeswitch with provided password: %s"
 	ECouldNotCreateMessage   = "Error while creating new message: %s"
 	ECouldNotSendEvent       = "Must send at least one event header, detected `%d` header"
+	EInvalidEventFormat      = "Invalid event format %q, supported formats are plain, json and xml"
+	EMissingEvents           = "At least one event name must be provided"
+)
+
+var (
+	// ErrConnectionLost - Matched by errors returned once connection is broken, use errors.Is
+	ErrConnectionLost = errors.New("connection lost")
+	// ErrCommandRejected - Matched by ReplyError, use errors.Is
+	ErrCommandRejected = errors.New("command rejected")
 )
+
+// ConnectionError - Returned by ReadMessage, pending requests and writes when connection is broken
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("connection lost: %s", e.Err)
+}
+
+// Unwrap - Will return underlying error e.g. io.EOF
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// Is - Makes errors.Is(err, ErrConnectionLost) true
+func (e *ConnectionError) Is(target error) bool {
+	return target == ErrConnectionLost
+}
+
+// ReplyError - Returned when freeswitch rejects a command with -ERR
+type ReplyError struct {
+	Command string
+	Reply   string
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Reply)
+}
+
+// Is - Makes errors.Is(err, ErrCommandRejected) true
+func (e *ReplyError) Is(target error) bool {
+	return target == ErrCommandRejected
+}
@@ -25,9 +25,14 @@ func (sc *SocketConnection) ExecuteHangup(uuid string, args string, sync bool) e
 	return sc.Execute("hangup", args, sync)
 }
 
-// API - Helper designed to attach api in front of the command so that you do not need to write it
-func (sc *SocketConnection) API(command string) error {
-	return sc.Send("api " + command)
+// API - Helper designed to attach api in front of the command so that you do not need to write it.
+// Blocks until api/response is received and returns its body, -ERR responses are returned as *ReplyError
+func (sc *SocketConnection) API(command string) (string, error) {
+	msg, err := sc.Request("api " + command)
+	if msg == nil {
+		return "", err
+	}
+	return string(msg.Body), err
 }
 
 // Connect - Helper designed to help you handle connection. Each outbound server when handling needs to connect e.g. accept
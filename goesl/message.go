@@ -10,6 +10,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"net/textproto"
@@ -23,6 +24,11 @@ var (
 	msgLogger = goeslLogger.CreateChild("message")
 )
 
+const (
+	arrayHeaderPrefix    = "ARRAY::"
+	arrayHeaderSeparator = "|:"
+)
+
 // Message - Freeswitch Message that is received by GoESL. Message struct is here to help with parsing message
 // and dumping its contents. In addition to that it's here to make sure received message is in fact message we wish/can support
 type Message struct {
@@ -45,8 +51,33 @@ func (m *Message) GetCallUUID() string {
 }
 
 // GetHeader - Will return message header value, or "" if the key is not set.
+// Headers read as MIME (e.g. channel data in connect reply) are stored canonicalized so Unique-ID is looked up as Unique-Id too
 func (m *Message) GetHeader(key string) string {
-	return m.Headers[key]
+	if v, found := m.Headers[key]; found {
+		return v
+	}
+	return m.Headers[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// GetReplyText - Will return Reply-Text of command/reply or body of api/response
+func (m *Message) GetReplyText() string {
+	if m.msgType == "api/response" {
+		return strings.TrimSpace(string(m.Body))
+	}
+	return m.GetHeader("Reply-Text")
+}
+
+// GetHeaderValues - Will return all values of a header. Array headers (e.g. variable_DP_MATCH) return
+// every item, other headers return a single value and missing headers return nil
+func (m *Message) GetHeaderValues(key string) []string {
+	v, found := m.Headers[key]
+	if !found {
+		v, found = m.Headers[textproto.CanonicalMIMEHeaderKey(key)]
+	}
+	if !found {
+		return nil
+	}
+	return DecodeArrayHeader(v)
 }
 
 // GetType - Will return message content type
@@ -96,8 +127,8 @@ func (m *Message) Parse() error {
 		return fmt.Errorf(EUnsupportedMessageType, m.msgType, AvailableMessageTypes)
 	}
 
-	// Assing message headers IF message is not type of event-json
-	if m.msgType != "text/event-json" {
+	// Assing message headers IF message is not an event, event headers are read from body
+	if !strings.HasPrefix(m.msgType, "text/event-") {
 		for k, v := range cmr {
 
 			m.Headers[k] = v[0]
@@ -133,23 +164,31 @@ func (m *Message) Parse() error {
 			//return fmt.Errorf(EUnsuccessfulReply, string(m.Body)[5:])
 		}
 	case "text/event-json":
-		// OK, what is missing here is a way to interpret other JSON types - it expects string only (understandably
-		// because the FS events are generally "string: string") - extract into empty interface and migrate only strings.
+		// FS events are generally "string: string" but some values are arrays
 		// i.e. Event CHANNEL_EXECUTE_COMPLETE - "variable_DP_MATCH":["a=rtpmap:101 telephone-event/8000","101"]
+		// Arrays are kept in freeswitch plain format (ARRAY::a|:b) so GetHeader still returns them and
+		// GetHeaderValues splits them. Numbers and other values are kept as their JSON text
 		var decoded map[string]interface{}
 
-		if err := json.Unmarshal(m.Body, &decoded); err != nil {
+		d := json.NewDecoder(bytes.NewReader(m.Body))
+		d.UseNumber()
+		if err := d.Decode(&decoded); err != nil {
 			return err
 		}
 
 		// Copy back in:
 		for k, v := range decoded {
-			switch v.(type) {
+			switch tv := v.(type) {
 			case string:
-				m.Headers[k] = v.(string)
+				m.Headers[k] = tv
+			case []interface{}:
+				values := make([]string, len(tv))
+				for i, item := range tv {
+					values[i] = jsonValueString(item)
+				}
+				m.Headers[k] = EncodeArrayHeader(values)
 			default:
-				//delete(m.Headers, k)
-				msgLogger.Warning("Removed non-string property (%s)", k)
+				m.Headers[k] = jsonValueString(v)
 			}
 		}
 
@@ -162,33 +201,116 @@ func (m *Message) Parse() error {
 		msgLogger.Debug("Parse() new event:%s", m.Headers["Event-Name"])
 
 	case "text/event-plain":
-		r := bufio.NewReader(bytes.NewReader(m.Body))
+		if err := m.parsePlainEvent(); err != nil {
+			return err
+		}
+		msgLogger.Debug("Parse() new event:%s", m.Headers["Event-Name"])
 
-		tr := textproto.NewReader(r)
+	case "text/event-xml":
+		if err := m.parseXMLEvent(); err != nil {
+			return err
+		}
+		msgLogger.Debug("Parse() new event:%s", m.Headers["Event-Name"])
+	}
 
-		emh, err := tr.ReadMIMEHeader()
+	return nil
+}
 
+// parsePlainEvent - Will read url encoded event headers from body of text/event-plain message.
+// Header names are kept as sent, unlike MIME headers which textproto canonicalizes
+func (m *Message) parsePlainEvent() error {
+	r := bufio.NewReader(bytes.NewReader(m.Body))
+	m.Body = []byte("")
+
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if i := strings.Index(line, ": "); i > 0 {
+			m.Headers[line[:i]] = decodeHeaderValue(line[i+2:])
+		}
 		if err != nil {
-			return fmt.Errorf(ECouldNotReadMIMEHeaders, err)
+			return nil
 		}
+	}
 
-		if vl := emh.Get("Content-Length"); vl != "" {
-			length, err := strconv.Atoi(vl)
+	if vl := m.Headers["Content-Length"]; vl != "" {
+		length, err := strconv.Atoi(vl)
 
-			if err != nil {
-				msgLogger.Error(EInvalidContentLength, err)
-				return err
-			}
+		if err != nil {
+			msgLogger.Error(EInvalidContentLength, err)
+			return err
+		}
+
+		m.Body = make([]byte, length)
+
+		if _, err = io.ReadFull(r, m.Body); err != nil {
+			msgLogger.Error(ECouldNotReadyBody, err)
+			return err
+		}
+	}
+	return nil
+}
 
-			m.Body = make([]byte, length)
+// decodeHeaderValue - Will decode url encoded event header value. Freeswitch encodes + as %2B so a literal +
+// (e.g. of +15551234 caller ids) is kept rather than turned to space
+func decodeHeaderValue(v string) string {
+	if !strings.Contains(v, "%") {
+		return v
+	}
+	decoded, err := url.PathUnescape(v)
+	if err != nil {
+		msgLogger.Error(ECouldNotDecode, err)
+		return v
+	}
+	return decoded
+}
 
-			if _, err = io.ReadFull(r, m.Body); err != nil {
-				msgLogger.Error(ECouldNotReadyBody, err)
-				return err
+// parseXMLEvent - Will read url encoded event headers from body of text/event-xml message which looks like
+// <event><headers><Event-Name>CUSTOM</Event-Name>...</headers><body>...</body></event>.
+// Repeated header elements are array items and are stored like plain array headers
+func (m *Message) parseXMLEvent() error {
+	d := xml.NewDecoder(bytes.NewReader(m.Body))
+	m.Body = []byte("")
+
+	values := map[string][]string{}
+	var path []string
+	var text []byte
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf(ECouldNotDecode, err)
+		}
+		switch tt := t.(type) {
+		case xml.StartElement:
+			path = append(path, tt.Name.Local)
+			text = text[:0]
+		case xml.CharData:
+			text = append(text, tt...)
+		case xml.EndElement:
+			switch {
+			case len(path) == 3 && path[1] == "headers":
+				values[tt.Name.Local] = append(values[tt.Name.Local], decodeHeaderValue(string(text)))
+			case len(path) == 2 && path[1] == "body":
+				m.Body = append([]byte(nil), text...)
 			}
+			path = path[:len(path)-1]
+			text = text[:0]
 		}
 	}
 
+	for k, v := range values {
+		if len(v) == 1 {
+			m.Headers[k] = v[0]
+		} else {
+			m.Headers[k] = EncodeArrayHeader(v)
+		}
+	}
 	return nil
 }
 
@@ -211,6 +333,36 @@ func (m *Message) Dump() (resp string) {
 	return
 }
 
+// EncodeArrayHeader - Will encode values the way freeswitch encodes array headers in plain events
+func EncodeArrayHeader(values []string) string {
+	return arrayHeaderPrefix + strings.Join(values, arrayHeaderSeparator)
+}
+
+// DecodeArrayHeader - Will split a freeswitch array header (ARRAY::a|:b), other values are returned as is
+func DecodeArrayHeader(v string) []string {
+	if !strings.HasPrefix(v, arrayHeaderPrefix) {
+		return []string{v}
+	}
+	return strings.Split(v[len(arrayHeaderPrefix):], arrayHeaderSeparator)
+}
+
+// jsonValueString - Will convert decoded json value to header text
+func jsonValueString(v interface{}) string {
+	switch tv := v.(type) {
+	case string:
+		return tv
+	case nil:
+		return ""
+	case json.Number:
+		return tv.String()
+	case bool:
+		return strconv.FormatBool(tv)
+	default:
+		b, _ := json.Marshal(tv)
+		return string(b)
+	}
+}
+
 // newMessage - Will build and execute parsing against received freeswitch message.
 // As return will give brand new Message{} for you to use it.
 func newMessage(r *bufio.Reader, autoParse bool) (*Message, error) {
@@ -0,0 +1,96 @@
+package goesl
+
+import (
+	"bufio"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//parseEvent parses an event of content type ctype with body
+func parseEvent(t *testing.T, ctype string, body string) *Message {
+	t.Helper()
+	raw := fmt.Sprintf("Content-Type: %s\nContent-Length: %d\n\n%s", ctype, len(body), body)
+	msg, err := newMessage(bufio.NewReader(strings.NewReader(raw)), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestJSONEventValues(t *testing.T) {
+	msg := parseEvent(t, "text/event-json", `{"Event-Name":"CHANNEL_EXECUTE_COMPLETE",`+
+		`"variable_DP_MATCH":["a=rtpmap:101 telephone-event/8000","101"],`+
+		`"Event-Sequence":12345678901234,"variable_is_moderator":true,"variable_empty":null}`)
+
+	want := []string{"a=rtpmap:101 telephone-event/8000", "101"}
+	if v := msg.GetHeaderValues("variable_DP_MATCH"); !reflect.DeepEqual(v, want) {
+		t.Errorf("unexpected array values %q", v)
+	}
+	if v := msg.GetHeader("variable_DP_MATCH"); v != "ARRAY::a=rtpmap:101 telephone-event/8000|:101" {
+		t.Errorf("unexpected array header %q", v)
+	}
+	if v := msg.GetHeader("Event-Sequence"); v != "12345678901234" {
+		t.Errorf("unexpected number %q", v)
+	}
+	if v := msg.GetHeader("variable_is_moderator"); v != "true" {
+		t.Errorf("unexpected bool %q", v)
+	}
+	if v := msg.GetHeaderValues("variable_empty"); !reflect.DeepEqual(v, []string{""}) {
+		t.Errorf("unexpected null %q", v)
+	}
+	if v := msg.GetHeaderValues("variable_missing"); v != nil {
+		t.Errorf("missing header returned %q", v)
+	}
+}
+
+func TestPlainArrayHeader(t *testing.T) {
+	msg := parseEvent(t, "text/event-plain", "Event-Name: CHANNEL_PARK\nvariable_DP_MATCH: ARRAY::a|:b\n"+
+		"variable_sip_from_display: John%20Doe\nCaller-Caller-ID-Number: %2B15551234\nvariable_plus: a+b%20c\n\n")
+
+	if v := msg.GetHeaderValues("variable_DP_MATCH"); !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Errorf("unexpected array values %q", v)
+	}
+	if v := msg.GetHeaderValues("variable_sip_from_display"); !reflect.DeepEqual(v, []string{"John Doe"}) {
+		t.Errorf("unexpected single value %q", v)
+	}
+	if v := msg.GetHeader("Caller-Caller-ID-Number"); v != "+15551234" {
+		t.Errorf("unexpected encoded plus %q", v)
+	}
+	if v := msg.GetHeader("variable_plus"); v != "a+b c" {
+		t.Errorf("literal plus is decoded %q", v)
+	}
+	if v := msg.GetHeaderValues("variable_missing"); v != nil {
+		t.Errorf("missing header returned %q", v)
+	}
+	if v := EncodeArrayHeader(DecodeArrayHeader("ARRAY::a|:b")); v != "ARRAY::a|:b" {
+		t.Errorf("array header does not round trip %q", v)
+	}
+}
+
+func TestXMLEvent(t *testing.T) {
+	msg := parseEvent(t, "text/event-xml", "<event>\n  <headers>\n"+
+		"    <Event-Name>CUSTOM</Event-Name>\n"+
+		"    <Caller-Caller-ID-Number>%2B15551234</Caller-Caller-ID-Number>\n"+
+		"    <variable_sip_from_display>John%20Doe%20%26%20Co</variable_sip_from_display>\n"+
+		"    <variable_DP_MATCH>a%3Drtpmap</variable_DP_MATCH>\n"+
+		"    <variable_DP_MATCH>101</variable_DP_MATCH>\n"+
+		"  </headers>\n  <body>a &lt;b&gt; 100%</body>\n</event>")
+
+	if v := msg.GetHeader("Event-Name"); v != "CUSTOM" {
+		t.Errorf("unexpected event name %q", v)
+	}
+	if v := msg.GetHeader("Caller-Caller-ID-Number"); v != "+15551234" {
+		t.Errorf("unexpected encoded plus %q", v)
+	}
+	if v := msg.GetHeader("variable_sip_from_display"); v != "John Doe & Co" {
+		t.Errorf("unexpected decoded value %q", v)
+	}
+	if v := msg.GetHeaderValues("variable_DP_MATCH"); !reflect.DeepEqual(v, []string{"a=rtpmap", "101"}) {
+		t.Errorf("unexpected array values %q", v)
+	}
+	if b := string(msg.Body); b != "a <b> 100%" {
+		t.Errorf("unexpected body %q", b)
+	}
+}
@@ -25,7 +25,10 @@ type OutboundServer struct {
 	Addr  string `json:"address"`
 	Proto string
 
-	Conns chan SocketConnection
+	Conns chan *SocketConnection
+
+	// Trace - If set, traffic of accepted connections is recorded to it
+	Trace *TraceWriter
 }
 
 // Start - Will start new outbound server
@@ -55,17 +58,17 @@ func (s *OutboundServer) Start() error {
 				break
 			}
 
-			conn := SocketConnection{
-				Conn: c,
-				err:  make(chan error),
-				m:    make(chan *Message),
+			if s.Trace != nil {
+				c = s.Trace.Wrap(c)
 			}
 
+			conn := newSocketConnection(c)
+
 			serverLogger.Notice("Got new connection from: %s", conn.OriginatorAddr())
 
 			go conn.Handle()
 
-			s.Conns <- conn
+			s.Conns <- &conn
 		}
 	}()
 
@@ -96,7 +99,7 @@ func NewOutboundServer(addr string) (*OutboundServer, error) {
 	server := OutboundServer{
 		Addr:  addr,
 		Proto: "tcp",
-		Conns: make(chan SocketConnection),
+		Conns: make(chan *SocketConnection),
 	}
 
 	sig := make(chan os.Signal, 1)
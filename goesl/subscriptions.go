@@ -0,0 +1,295 @@
+package goesl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EventFilter - Header and value of a filter command, only events having header with value are received
+type EventFilter struct {
+	Header string
+	Value  string
+}
+
+// Subscriptions - What a connection listens to as recorded by its subscription methods.
+// Commands sent as raw strings with Send are not tracked
+type Subscriptions struct {
+	// Format of received events, empty when not listening to events
+	Format string
+	// Events names in subscription order, ALL stands for every event
+	Events []string
+	// Subclasses of subscribed CUSTOM events
+	Subclasses []string
+	Filters    []EventFilter
+	// MyEvents is set once myevents is sent, MyEventsUUID is its uuid for inbound connections
+	MyEvents     bool
+	MyEventsUUID string
+	DivertEvents bool
+	// Linger is set by linger, LingerTime is its seconds, 0 for freeswitch default
+	Linger     bool
+	LingerTime int
+}
+
+// copy - Returns a deep copy so callers can not change tracked state
+func (s Subscriptions) copy() Subscriptions {
+	s.Events = append([]string(nil), s.Events...)
+	s.Subclasses = append([]string(nil), s.Subclasses...)
+	s.Filters = append([]EventFilter(nil), s.Filters...)
+	return s
+}
+
+// commands - Returns commands which restore subscriptions on a new connection
+func (s Subscriptions) commands() []string {
+	var cmds []string
+	if s.MyEvents {
+		cmds = append(cmds, myEventsCommand(s.Format, s.MyEventsUUID))
+	}
+	if s.Format != "" && (len(s.Events) > 0 || len(s.Subclasses) > 0) {
+		cmds = append(cmds, eventCommand("event "+s.Format, s.Events, s.Subclasses))
+	}
+	for _, f := range s.Filters {
+		cmds = append(cmds, "filter "+f.Header+" "+f.Value)
+	}
+	if s.DivertEvents {
+		cmds = append(cmds, "divert_events on")
+	}
+	if s.Linger {
+		cmds = append(cmds, lingerCommand(s.LingerTime))
+	}
+	return cmds
+}
+
+// splitEvents - Splits event arguments to names and CUSTOM subclasses, like freeswitch every argument
+// following CUSTOM is a subclass
+func splitEvents(events []string) (names []string, subclasses []string) {
+	custom := false
+	for _, e := range events {
+		for _, f := range strings.Fields(e) {
+			if custom {
+				subclasses = append(subclasses, f)
+				continue
+			}
+			if f == "CUSTOM" {
+				custom = true
+				continue
+			}
+			names = append(names, f)
+		}
+	}
+	return names, subclasses
+}
+
+// eventCommand - Builds an event or nixevent command, subclasses follow CUSTOM
+func eventCommand(prefix string, names []string, subclasses []string) string {
+	args := append([]string{prefix}, names...)
+	if len(subclasses) > 0 {
+		args = append(args, "CUSTOM")
+		args = append(args, subclasses...)
+	}
+	return strings.Join(args, " ")
+}
+
+func myEventsCommand(format string, uuid string) string {
+	cmd := "myevents"
+	if format != "" {
+		cmd += " " + format
+	}
+	if uuid != "" {
+		cmd += " " + uuid
+	}
+	return cmd
+}
+
+func lingerCommand(seconds int) string {
+	if seconds > 0 {
+		return "linger " + strconv.Itoa(seconds)
+	}
+	return "linger"
+}
+
+func checkEventFormat(format string) error {
+	switch format {
+	case "plain", "json", "xml":
+		return nil
+	}
+	return fmt.Errorf(EInvalidEventFormat, format)
+}
+
+// addUnique - Appends values missing from list
+func addUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !containsString(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// removeAll - Removes values from list
+func removeAll(list []string, values ...string) []string {
+	result := list[:0]
+	for _, v := range list {
+		if !containsString(values, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscriptions - Returns a snapshot of active subscriptions
+func (c *SocketConnection) Subscriptions() Subscriptions {
+	c.subsMtx.Lock()
+	defer c.subsMtx.Unlock()
+	return c.subs.copy()
+}
+
+// subscribe - Sends cmd and records its effect once freeswitch accepts it, -ERR replies are returned as *ReplyError.
+// Like API it blocks until the reply, so messages must keep being handled and read by ReadMessage
+func (c *SocketConnection) subscribe(cmd string, update func(s *Subscriptions)) error {
+	c.subsMtx.Lock()
+	defer c.subsMtx.Unlock()
+	if _, err := c.Request(cmd); err != nil {
+		return err
+	}
+	update(&c.subs)
+	return nil
+}
+
+// Events - Subscribes to events in format (plain, json or xml), adding them to current subscriptions.
+// Custom events are subscribed by CUSTOM followed by their subclasses, e.g. Events("json", "CUSTOM", "conference::maniacs")
+func (c *SocketConnection) Events(format string, events ...string) error {
+	if err := checkEventFormat(format); err != nil {
+		return err
+	}
+	names, subclasses := splitEvents(events)
+	if len(names) == 0 && len(subclasses) == 0 {
+		return fmt.Errorf(EMissingEvents)
+	}
+	return c.subscribe(eventCommand("event "+format, names, subclasses), func(s *Subscriptions) {
+		s.Format = format
+		s.Events = addUnique(s.Events, names...)
+		s.Subclasses = addUnique(s.Subclasses, subclasses...)
+	})
+}
+
+// NixEvent - Unsubscribes events, arguments are the same as Events without format. ALL unsubscribes everything
+func (c *SocketConnection) NixEvent(events ...string) error {
+	names, subclasses := splitEvents(events)
+	if len(names) == 0 && len(subclasses) == 0 {
+		return fmt.Errorf(EMissingEvents)
+	}
+	return c.subscribe(eventCommand("nixevent", names, subclasses), func(s *Subscriptions) {
+		if containsString(names, "ALL") {
+			s.Events, s.Subclasses = nil, nil
+			return
+		}
+		s.Events = removeAll(s.Events, names...)
+		s.Subclasses = removeAll(s.Subclasses, subclasses...)
+	})
+}
+
+// NoEvents - Stops listening to events, filters are kept
+func (c *SocketConnection) NoEvents() error {
+	return c.subscribe("noevents", func(s *Subscriptions) {
+		s.Format, s.Events, s.Subclasses = "", nil, nil
+		s.MyEvents, s.MyEventsUUID = false, ""
+	})
+}
+
+// Filter - Adds a filter, once a filter exists only events matching one of filters are received
+func (c *SocketConnection) Filter(header string, value string) error {
+	f := EventFilter{Header: header, Value: value}
+	return c.subscribe("filter "+header+" "+value, func(s *Subscriptions) {
+		for _, existing := range s.Filters {
+			if existing == f {
+				return
+			}
+		}
+		s.Filters = append(s.Filters, f)
+	})
+}
+
+// FilterDelete - Deletes filter of header with value, every filter of header if value is empty
+// or every filter if header is "all"
+func (c *SocketConnection) FilterDelete(header string, value string) error {
+	cmd := "filter delete " + header
+	if value != "" {
+		cmd += " " + value
+	}
+	return c.subscribe(cmd, func(s *Subscriptions) {
+		filters := s.Filters[:0]
+		for _, f := range s.Filters {
+			if header == "all" || (f.Header == header && (value == "" || f.Value == value)) {
+				continue
+			}
+			filters = append(filters, f)
+		}
+		s.Filters = filters
+	})
+}
+
+// MyEvents - Subscribes to every event of one channel. Inbound connections pass uuid of channel,
+// outbound ones pass empty uuid for their own channel. Empty format keeps freeswitch default (plain)
+func (c *SocketConnection) MyEvents(format string, uuid string) error {
+	if format != "" {
+		if err := checkEventFormat(format); err != nil {
+			return err
+		}
+	}
+	return c.subscribe(myEventsCommand(format, uuid), func(s *Subscriptions) {
+		s.MyEvents, s.MyEventsUUID = true, uuid
+		if format != "" {
+			s.Format = format
+		} else if s.Format == "" {
+			s.Format = "plain"
+		}
+	})
+}
+
+// DivertEvents - Turns delivery of events sent to channel's event hooks (e.g. by ivr or conference) on or off
+func (c *SocketConnection) DivertEvents(on bool) error {
+	cmd := "divert_events off"
+	if on {
+		cmd = "divert_events on"
+	}
+	return c.subscribe(cmd, func(s *Subscriptions) {
+		s.DivertEvents = on
+	})
+}
+
+// Linger - Keeps outbound connection open after hangup so remaining events are received, seconds 0
+// lingers for freeswitch default time
+func (c *SocketConnection) Linger(seconds int) error {
+	return c.subscribe(lingerCommand(seconds), func(s *Subscriptions) {
+		s.Linger, s.LingerTime = true, seconds
+	})
+}
+
+// NoLinger - Cancels Linger
+func (c *SocketConnection) NoLinger() error {
+	return c.subscribe("nolinger", func(s *Subscriptions) {
+		s.Linger, s.LingerTime = false, 0
+	})
+}
+
+// resubscribe - Sends commands restoring tracked subscriptions, used after reconnect
+func (c *SocketConnection) resubscribe() error {
+	c.subsMtx.Lock()
+	defer c.subsMtx.Unlock()
+	for _, cmd := range c.subs.commands() {
+		if err := c.Send(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package goesl
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRejectedSubscriptionNotTracked(t *testing.T) {
+	c, p := newPipe(t)
+	go func() {
+		for _, reply := range []string{"+OK", "-ERR invalid filter", "+OK event listener enabled json"} {
+			if _, err := p.command(); err != nil {
+				return
+			}
+			p.reply(reply)
+		}
+	}()
+
+	if err := c.Filter("Event-Name", "CHANNEL_PARK"); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Filter("Unique-ID", "")
+	var replyErr *ReplyError
+	if !errors.As(err, &replyErr) || replyErr.Reply != "-ERR invalid filter" || !errors.Is(err, ErrCommandRejected) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := c.Events("json", "CHANNEL_PARK"); err != nil {
+		t.Fatal(err)
+	}
+	want := Subscriptions{Format: "json", Events: []string{"CHANNEL_PARK"},
+		Filters: []EventFilter{{Header: "Event-Name", Value: "CHANNEL_PARK"}}}
+	if subs := c.Subscriptions(); !reflect.DeepEqual(subs, want) {
+		t.Errorf("unexpected subscriptions %+v", subs)
+	}
+}
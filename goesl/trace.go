@@ -0,0 +1,134 @@
+package goesl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Trace directions
+const (
+	TraceIn  = "in"
+	TraceOut = "out"
+)
+
+// TraceRedacted - Replaces password of auth commands in traces
+const TraceRedacted = "[redacted]"
+
+// TraceWriter - Will record every raw frame read from or written to traced connections. Each record is a line
+// "<RFC3339Nano time> <connection id> <in|out> <length>" followed by raw bytes and a new line, so records
+// can be read back with ReadTrace. Password of auth is replaced by TraceRedacted. One writer can be shared
+// by several connections
+type TraceWriter struct {
+	w     io.Writer
+	mtx   sync.Mutex
+	conns uint64
+}
+
+// TraceRecord - One chunk of traffic of a traced connection
+type TraceRecord struct {
+	Time      time.Time
+	Conn      string
+	Direction string
+	Data      []byte
+}
+
+// NewTraceWriter - Will create trace writer over w, e.g. a file
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{w: w}
+}
+
+// Wrap - Will return conn which records its traffic under a new connection id
+func (t *TraceWriter) Wrap(conn net.Conn) net.Conn {
+	id := atomic.AddUint64(&t.conns, 1)
+	return &traceConn{Conn: conn, trace: t, id: strconv.FormatUint(id, 10)}
+}
+
+func (t *TraceWriter) record(conn string, direction string, b []byte) {
+	if direction == TraceOut && bytes.HasPrefix(b, []byte("auth ")) {
+		b = redactAuth(b)
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	header := fmt.Sprintf("%s %s %s %d\n", time.Now().Format(time.RFC3339Nano), conn, direction, len(b))
+	if _, err := io.WriteString(t.w, header); err != nil {
+		connectionLogger.Error("Could not write trace: %s", err)
+		return
+	}
+	t.w.Write(b)
+	io.WriteString(t.w, "\n")
+}
+
+// redactAuth - Will return copy of auth command b with password replaced
+func redactAuth(b []byte) []byte {
+	end := bytes.IndexAny(b, "\r\n")
+	if end < 0 {
+		end = len(b)
+	}
+	return append([]byte("auth "+TraceRedacted), b[end:]...)
+}
+
+// traceConn - net.Conn which records what is read and written
+type traceConn struct {
+	net.Conn
+	trace *TraceWriter
+	id    string
+}
+
+func (c *traceConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.trace.record(c.id, TraceIn, b[:n])
+	}
+	return n, err
+}
+
+func (c *traceConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.trace.record(c.id, TraceOut, b[:n])
+	}
+	return n, err
+}
+
+// ReadTrace - Will read all records written by TraceWriter
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+	br := bufio.NewReader(r)
+	var records []TraceRecord
+	for {
+		var ts string
+		var rec TraceRecord
+		var length int
+		_, err := fmt.Fscanf(br, "%s %s %s %d\n", &ts, &rec.Conn, &rec.Direction, &length)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("invalid trace record %d: %s", len(records)+1, err)
+		}
+		if rec.Time, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+			return records, err
+		}
+		rec.Data = make([]byte, length+1)
+		if _, err := io.ReadFull(br, rec.Data); err != nil {
+			return records, fmt.Errorf("truncated trace record %d: %s", len(records)+1, err)
+		}
+		rec.Data = rec.Data[:length]
+		records = append(records, rec)
+	}
+}
+
+// SplitTrace - Will group records by connection keeping their order
+func SplitTrace(records []TraceRecord) map[string][]TraceRecord {
+	result := make(map[string][]TraceRecord)
+	for _, r := range records {
+		result[r.Conn] = append(result[r.Conn], r)
+	}
+	return result
+}
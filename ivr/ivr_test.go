@@ -0,0 +1,190 @@
+package ivr_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	adapters "github.com/babakyakhchali/go-esl-wrapper/adapters"
+	eslsession "github.com/babakyakhchali/go-esl-wrapper/eslsession"
+	"github.com/babakyakhchali/go-esl-wrapper/esltest"
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	goesl "github.com/babakyakhchali/go-esl-wrapper/goesl"
+	"github.com/babakyakhchali/go-esl-wrapper/ivr"
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+type menuApp struct {
+	session fs.ISession
+	menu    *ivr.Menu
+	result  chan error
+}
+
+func (app *menuApp) IsApplicable(fs.IEvent) bool { return true }
+func (app *menuApp) Setup(fs.IEvent)             {}
+func (app *menuApp) Run()                        { app.result <- app.menu.Run(app.session) }
+
+//run runs menu on a fake channel whose callers enter digits in order, "" is a timeout.
+//Returns error of Run and apps executed on channel except digit collection
+func run(t *testing.T, menu *ivr.Menu, digits ...string) ([]string, error) {
+	t.Helper()
+	s, err := esltest.NewServer("ClueCon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var mtx sync.Mutex
+	s.HandleExecute("play_and_get_digits", func(ch *esltest.Channel, cmd esltest.Command) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(digits) == 0 {
+			t.Errorf("unexpected digit collection %s", cmd.AppArg())
+			ch.Hangup("NORMAL_CLEARING")
+			return
+		}
+		headers := map[string]string{}
+		if digits[0] != "" {
+			headers["variable_ivr_menu_digits"] = digits[0]
+		}
+		digits = digits[1:]
+		ch.CompleteExecute(cmd, headers)
+	})
+	client, err := goesl.NewClient(s.Host(), s.Port(), "ClueCon", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Handle()
+	result := make(chan error, 1)
+	m := eslsession.NewSessionManager(&adapters.EslWrapper{Client: client})
+	go m.Serve(func(s fs.ISession) eslsession.IEslApp {
+		return &menuApp{session: s, menu: menu, result: result}
+	})
+	if err := s.WaitSubscribed(0); err != nil {
+		t.Fatal(err)
+	}
+	ch := s.NewChannel(nil)
+	ch.Park()
+
+	select {
+	case err = <-result:
+	case <-time.After(5 * time.Second):
+		t.Fatal("menu did not return")
+	}
+	var apps []string
+	for _, c := range ch.Executes() {
+		switch c.App() {
+		case "play_and_get_digits", "unset":
+		case "playback", "transfer", "hangup":
+			apps = append(apps, c.App()+" "+c.AppArg())
+		default:
+			apps = append(apps, c.App())
+		}
+	}
+	return apps, err
+}
+
+func TestMain(m *testing.M) {
+	ivr.SetLogLevel(l.ERROR)
+	eslsession.SetLogLevel(l.ERROR)
+	goesl.SetLogLevel(l.ERROR)
+	os.Exit(m.Run())
+}
+
+const mainMenu = `{
+  "name": "main",
+  "greeting": "main.wav",
+  "short_greeting": "main-short.wav",
+  "invalid_sound": "invalid.wav",
+  "exit_sound": "bye.wav",
+  "entries": {
+    "1": {"type": "menu", "menu": {
+      "name": "sales",
+      "greeting": "sales.wav",
+      "entries": {
+        "1": {"type": "playback", "data": "prices.wav"},
+        "*": {"type": "back"},
+        "0": {"type": "top"}
+      }
+    }},
+    "2": {"type": "transfer", "data": "1000 XML default"},
+    "9": {"type": "exit"}
+  }
+}`
+
+func TestNavigation(t *testing.T) {
+	menu, err := ivr.Load(strings.NewReader(mainMenu))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apps, err := run(t, menu, "5", "1", "1", "", "*", "9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"playback invalid.wav", "playback prices.wav", "playback bye.wav"}
+	if !reflect.DeepEqual(apps, want) {
+		t.Errorf("unexpected apps\n%v\n%v", apps, want)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	menu, err := ivr.Load(strings.NewReader(mainMenu))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apps, err := run(t, menu, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"playback bye.wav", "transfer 1000 XML default"}; !reflect.DeepEqual(apps, want) {
+		t.Errorf("unexpected apps %v", apps)
+	}
+}
+
+func TestMaxFailures(t *testing.T) {
+	called := ""
+	menu := &ivr.Menu{
+		Name:        "pin",
+		Greeting:    "enter-pin.wav",
+		MaxFailures: 2,
+		Entries: map[string]*ivr.Action{
+			"1234": {Type: ivr.ActionFunc, Func: func(s fs.ISession, digits string) error {
+				called = digits
+				return nil
+			}},
+		},
+	}
+	_, err := run(t, menu, "1111", "1234", "", "2222", "3333")
+	if !errors.Is(err, ivr.ErrMaxFailures) {
+		t.Errorf("expected max failures, got %v", err)
+	}
+	if called != "1234" {
+		t.Errorf("func action was not called")
+	}
+
+	menu.OnFailure = &ivr.Action{Type: ivr.ActionHangup, Data: "CALL_REJECTED"}
+	apps, err := run(t, menu, "1111", "2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"hangup CALL_REJECTED"}; !reflect.DeepEqual(apps, want) {
+		t.Errorf("unexpected apps %v", apps)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, menu := range []string{
+		`{"name": "empty"}`,
+		`{"name": "m", "entries": {"1": {"type": "dance"}}}`,
+		`{"name": "m", "entries": {"a": {"type": "exit"}}}`,
+		`{"name": "m", "entries": {"1": {"type": "menu"}}}`,
+		`{"name": "m", "entries": {"1": {"type": "exec"}}}`,
+	} {
+		if _, err := ivr.Load(strings.NewReader(menu)); err == nil {
+			t.Errorf("expected %s to be invalid", menu)
+		}
+	}
+}
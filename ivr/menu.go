@@ -0,0 +1,183 @@
+//Package ivr runs voice menus defined as data, like freeswitch ivr_menu but driven from go.
+//Menus are built as go structs or loaded from json:
+//
+//	{
+//	  "name": "main",
+//	  "greeting": "ivr/ivr-welcome.wav",
+//	  "invalid_sound": "ivr/ivr-that_was_an_invalid_entry.wav",
+//	  "max_failures": 3,
+//	  "entries": {
+//	    "1": {"type": "menu", "menu": {"name": "sales", "greeting": "ivr/sales.wav", "entries": {"*": {"type": "back"}}}},
+//	    "2": {"type": "transfer", "data": "1000 XML default"},
+//	    "9": {"type": "exit"}
+//	  }
+//	}
+package ivr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+	l "github.com/babakyakhchali/go-esl-wrapper/logger"
+)
+
+var (
+	ivrLogger = l.NewLogger("ivr")
+)
+
+//SetLogLevel set loglevel for ivr logger
+func SetLogLevel(l int) {
+	ivrLogger.SetLevel(l)
+}
+
+//action types
+const (
+	//ActionMenu enters sub menu Action.Menu
+	ActionMenu = "menu"
+	//ActionBack returns to parent menu, leaves ivr on top menu
+	ActionBack = "back"
+	//ActionTop returns to top menu
+	ActionTop = "top"
+	//ActionExit leaves ivr
+	ActionExit = "exit"
+	//ActionExec runs application App with Data and repeats current menu
+	ActionExec = "exec"
+	//ActionPlayback plays Data and repeats current menu
+	ActionPlayback = "playback"
+	//ActionTransfer transfers channel to Data (extension [dialplan] [context]) and leaves ivr
+	ActionTransfer = "transfer"
+	//ActionHangup hangs up channel with cause Data and leaves ivr
+	ActionHangup = "hangup"
+	//ActionFunc calls Action.Func and repeats current menu, only for menus built in go
+	ActionFunc = "func"
+)
+
+//default menu settings, same as freeswitch ivr_menu
+const (
+	DefaultTimeout           = 10000
+	DefaultInterDigitTimeout = 2000
+	DefaultMaxFailures       = 3
+	DefaultMaxTimeouts       = 3
+)
+
+//EntryFunc is called by a func action with digits which selected it
+type EntryFunc func(s fs.ISession, digits string) error
+
+//Action is what happens when an entry is selected or a menu fails
+type Action struct {
+	Type string `json:"type"`
+	App  string `json:"app,omitempty"`
+	Data string `json:"data,omitempty"`
+	Menu *Menu  `json:"menu,omitempty"`
+
+	Func EntryFunc `json:"-"`
+}
+
+//Menu is one level of ivr
+type Menu struct {
+	Name string `json:"name"`
+	//Greeting is played when menu is entered
+	Greeting string `json:"greeting"`
+	//ShortGreeting is played when menu is repeated, Greeting is used if empty
+	ShortGreeting string `json:"short_greeting,omitempty"`
+	InvalidSound  string `json:"invalid_sound,omitempty"`
+	//TimeoutSound is played when no digit is pressed, InvalidSound is used if empty
+	TimeoutSound string `json:"timeout_sound,omitempty"`
+	//ExitSound is played when ivr is left from this menu
+	ExitSound string `json:"exit_sound,omitempty"`
+	//Timeout and InterDigitTimeout are milliseconds
+	Timeout           int `json:"timeout,omitempty"`
+	InterDigitTimeout int `json:"inter_digit_timeout,omitempty"`
+	MaxFailures       int `json:"max_failures,omitempty"`
+	MaxTimeouts       int `json:"max_timeouts,omitempty"`
+	//DigitLen is maximum digits of an entry, length of longest entry if 0
+	DigitLen int `json:"digit_len,omitempty"`
+
+	Entries map[string]*Action `json:"entries"`
+	//OnFailure runs when max failures or timeouts is reached, ivr is left with ErrMaxFailures if it is nil
+	OnFailure *Action `json:"on_failure,omitempty"`
+}
+
+//Load reads a menu from json and validates it
+func Load(r io.Reader) (*Menu, error) {
+	var m Menu
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+//LoadFile reads a menu from a json file
+func LoadFile(path string) (*Menu, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+//Validate checks menu and its sub menus for unknown action types and missing action arguments
+func (m *Menu) Validate() error {
+	return m.validate(map[*Menu]bool{})
+}
+
+func (m *Menu) validate(seen map[*Menu]bool) error {
+	if seen[m] { //menus built in go may refer to each other
+		return nil
+	}
+	seen[m] = true
+	if len(m.Entries) == 0 {
+		return fmt.Errorf("menu %s has no entries", m.Name)
+	}
+	for digits, a := range m.Entries {
+		if digits == "" || strings.Trim(digits, "0123456789*#") != "" {
+			return fmt.Errorf("menu %s: invalid entry digits %q", m.Name, digits)
+		}
+		if err := a.validate(seen); err != nil {
+			return fmt.Errorf("menu %s entry %s: %s", m.Name, digits, err)
+		}
+	}
+	if m.OnFailure != nil {
+		if err := m.OnFailure.validate(seen); err != nil {
+			return fmt.Errorf("menu %s on_failure: %s", m.Name, err)
+		}
+	}
+	return nil
+}
+
+func (a *Action) validate(seen map[*Menu]bool) error {
+	if a == nil {
+		return fmt.Errorf("missing action")
+	}
+	switch a.Type {
+	case ActionMenu:
+		if a.Menu == nil {
+			return fmt.Errorf("menu action without menu")
+		}
+		return a.Menu.validate(seen)
+	case ActionExec:
+		if a.App == "" {
+			return fmt.Errorf("exec action without app")
+		}
+	case ActionPlayback, ActionTransfer:
+		if a.Data == "" {
+			return fmt.Errorf("%s action without data", a.Type)
+		}
+	case ActionFunc:
+		if a.Func == nil {
+			return fmt.Errorf("func action without func")
+		}
+	case ActionBack, ActionTop, ActionExit, ActionHangup:
+	default:
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package ivr
+
+import (
+	"errors"
+	"strings"
+
+	fs "github.com/babakyakhchali/go-esl-wrapper/fs"
+)
+
+//ErrMaxFailures is returned by Run when a menu without OnFailure reaches its max failures or timeouts
+var ErrMaxFailures = errors.New("ivr max failures reached")
+
+//digitsVar is channel variable play_and_get_digits stores entries in
+const digitsVar = "ivr_menu_digits"
+
+//Run plays menu on session and follows selected entries until ivr is left. Returns nil when left by an
+//exit, back, transfer or hangup action, ErrMaxFailures or the error of a failed session operation
+func (m *Menu) Run(s fs.ISession) error {
+	stack := []*Menu{m}
+	repeated := false
+	failures, timeouts := 0, 0
+	for {
+		cur := stack[len(stack)-1]
+		greeting := cur.Greeting
+		if repeated && cur.ShortGreeting != "" {
+			greeting = cur.ShortGreeting
+		}
+		digits, err := cur.collect(s, greeting)
+		if err != nil {
+			return err
+		}
+		repeated = true
+
+		var action *Action
+		if digits == "" {
+			timeouts++
+			ivrLogger.Debug("menu %s timeout %d", cur.Name, timeouts)
+			if err := play(s, cur.TimeoutSound, cur.InvalidSound); err != nil {
+				return err
+			}
+		} else if action = cur.Entries[digits]; action == nil {
+			failures++
+			ivrLogger.Debug("menu %s invalid entry %s", cur.Name, digits)
+			if err := play(s, cur.InvalidSound); err != nil {
+				return err
+			}
+		}
+		if action == nil {
+			if failures < orDefault(cur.MaxFailures, DefaultMaxFailures) && timeouts < orDefault(cur.MaxTimeouts, DefaultMaxTimeouts) {
+				continue
+			}
+			if cur.OnFailure == nil {
+				if err := play(s, cur.ExitSound); err != nil {
+					return err
+				}
+				return ErrMaxFailures
+			}
+			action = cur.OnFailure
+		}
+		failures, timeouts = 0, 0
+
+		ivrLogger.Debug("menu %s entry %s: %s", cur.Name, digits, action.Type)
+		switch action.Type {
+		case ActionMenu:
+			stack = append(stack, action.Menu)
+			repeated = false
+		case ActionBack:
+			if len(stack) == 1 {
+				return play(s, cur.ExitSound)
+			}
+			stack = stack[:len(stack)-1]
+			repeated = false
+		case ActionTop:
+			stack = stack[:1]
+			repeated = false
+		case ActionExit:
+			return play(s, cur.ExitSound)
+		case ActionExec:
+			_, err = s.Exec(action.App, action.Data)
+		case ActionPlayback:
+			_, err = s.Playback(action.Data)
+		case ActionFunc:
+			err = action.Func(s, digits)
+		case ActionTransfer:
+			if err := play(s, cur.ExitSound); err != nil {
+				return err
+			}
+			_, err = s.Exec("transfer", action.Data)
+			return err
+		case ActionHangup:
+			if action.Data != "" {
+				_, err = s.Hangup(action.Data)
+			} else {
+				_, err = s.Hangup()
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//collect plays prompt and returns entered digits, empty on timeout
+func (m *Menu) collect(s fs.ISession, prompt string) (string, error) {
+	if prompt == "" {
+		prompt = "silence_stream://250"
+	}
+	maxDigits := m.DigitLen
+	terminators := "#"
+	for digits := range m.Entries {
+		if m.DigitLen == 0 && len(digits) > maxDigits {
+			maxDigits = len(digits)
+		}
+		if strings.Contains(digits, "#") { //# is an entry so digits are not terminated
+			terminators = "none"
+		}
+	}
+	e, err := s.PlayAndGetDigits(1, uint(maxDigits), 1, uint(orDefault(m.Timeout, DefaultTimeout)), terminators, prompt,
+		"''", digitsVar, "[0-9*#]+", uint(orDefault(m.InterDigitTimeout, DefaultInterDigitTimeout)), "")
+	if err != nil {
+		return "", err
+	}
+	digits := e.GetHeader("variable_" + digitsVar)
+	if digits != "" { //so a later timeout is not read as the same entry
+		if _, err := s.Unset(digitsVar); err != nil {
+			return "", err
+		}
+	}
+	return digits, nil
+}
+
+//play plays first non empty sound
+func play(s fs.ISession, sounds ...string) error {
+	for _, sound := range sounds {
+		if sound != "" {
+			_, err := s.Playback(sound)
+			return err
+		}
+	}
+	return nil
+}
+
+func orDefault(v int, d int) int {
+	if v > 0 {
+		return v
+	}
+	return d
+}
@@ -27,12 +27,12 @@ func appFactory(s fs.ISession) eslession.IEslApp {
 		session: s,
 	}
 }
-func testBgAPI() {
+func testBgAPI(m *eslession.SessionManager) {
 	t := time.NewTicker(5 * time.Second)
 	apistr := "show calls"
 	go func() {
 		for range t.C {
-			r, e := eslession.BgAPI(apistr, 3)
+			r, e := m.BgAPI(apistr, 3)
 			if e != nil {
 				appLogger.Error("Error issuing bgapi: %s", e)
 			} else {
@@ -45,24 +45,21 @@ func testBgAPI() {
 func main() {
 	goesl.SetLogLevel(l.ERROR)
 
-	for i := 0; i < 600; i++ {
-		client, err := goesl.NewClient("127.0.0.1", 8021, "ClueCon", 3)
-		w := &adapters.EslWrapper{Client: client}
-
-		if err != nil {
-			appLogger.Error("Error while creating new client: %s", err)
-			break
-		}
-
-		go client.Handle()
+	client, err := goesl.NewClient("127.0.0.1", 8021, "ClueCon", 3)
+	if err != nil {
+		appLogger.Error("Error while creating new client: %s", err)
+		return
+	}
+	w := &adapters.EslWrapper{Client: client}
 
-		go testBgAPI()
+	go client.Handle()
 
-		//client.Send("events json CHANNEL_HANGUP CHANNEL_EXECUTE CHANNEL_EXECUTE_COMPLETE CHANNEL_PARK CHANNEL_DESTROY")
-		eslession.EslConnectionHandler(w, appFactory)
+	m := eslession.NewSessionManager(w)
+	m.EnableReconnect(eslession.DefaultReconnectPolicy)
+	go testBgAPI(m)
 
-		appLogger.Info("Socket closed retrying %d", i)
-		time.Sleep(10 * time.Millisecond)
+	if err := m.Serve(appFactory); err != nil {
+		appLogger.Error("Connection closed: %s", err)
 	}
 	appLogger.Info("App exitted")
 }